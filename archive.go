@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// posts grouped by year and month, newest first
+type Archive struct {
+	Years   []ArchiveYear
+	Undated Posts
+}
+
+type ArchiveYear struct {
+	Year   int
+	Months []ArchiveMonth
+}
+
+type ArchiveMonth struct {
+	Month time.Month
+	Posts Posts
+}
+
+// group sorted, newest first posts by year and month. posts without a date
+// end up in Undated.
+func buildArchive(posts Posts) Archive {
+	archive := Archive{}
+	for _, post := range posts {
+		if post.Date.IsZero() {
+			archive.Undated = append(archive.Undated, post)
+			continue
+		}
+
+		year, month := post.Date.Year(), post.Date.Month()
+		if n := len(archive.Years); n == 0 || archive.Years[n-1].Year != year {
+			archive.Years = append(archive.Years, ArchiveYear{Year: year})
+		}
+		y := &archive.Years[len(archive.Years)-1]
+		if n := len(y.Months); n == 0 || y.Months[n-1].Month != month {
+			y.Months = append(y.Months, ArchiveMonth{Month: month})
+		}
+		m := &y.Months[len(y.Months)-1]
+		m.Posts = append(m.Posts, post)
+	}
+	return archive
+}
+
+// write archive.html from the optional archive.html template
+func writeArchive(posts Posts) error {
+	tmplPath := filepath.Join(config.TemplateDir, "archive.html")
+	if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	// sort posts
+	sort.Sort(posts)
+
+	out, err := renderTemplate(tmplPath, buildArchive(posts))
+	if err != nil {
+		return err
+	}
+
+	page := Page{
+		"Archive",
+		string(out),
+	}
+
+	// tuck archive into main template
+	out, err = renderTemplate(filepath.Join(config.TemplateDir, "main.html"), page)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, filepath.FromSlash(pagePath("archive"))), out)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildArchive(t *testing.T) {
+	var posts Posts
+	for i, d := range []time.Time{
+		time.Date(2019, 11, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2019, 12, 31, 23, 59, 0, 0, time.UTC),
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+		{},
+	} {
+		posts = append(posts, Post{Title: fmt.Sprintf("p%d", i), Date: d})
+	}
+	sort.Sort(posts)
+	archive := buildArchive(posts)
+
+	var groups []string
+	for _, y := range archive.Years {
+		for _, m := range y.Months {
+			var titles []string
+			for _, p := range m.Posts {
+				titles = append(titles, p.Title)
+			}
+			groups = append(groups, fmt.Sprintf("%d-%02d:%v", y.Year, m.Month, strings.Join(titles, ",")))
+		}
+	}
+	want := "2020-01:p4,p3 2019-12:p2,p1 2019-11:p0"
+	if got := strings.Join(groups, " "); got != want {
+		t.Errorf("archive = %v, want %v", got, want)
+	}
+	if len(archive.Undated) != 1 || archive.Undated[0].Title != "p5" {
+		t.Errorf("undated = %+v", archive.Undated)
+	}
+}
+
+func TestArchivePage(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2019-12-31-old.md", "# Old\n")
+	writeSource(t, "2020-01-01-new.md", "# New\n")
+	testBuild(t)
+
+	page := readOutput(t, "archive.html")
+	if i, j := strings.Index(page, "2020"), strings.Index(page, "2019"); i < 0 || j < 0 || i > j {
+		t.Errorf("archive doesn't list 2020 before 2019:\n%s", page)
+	}
+	if !strings.Contains(page, "<title>Archive</title>") {
+		t.Errorf("archive isn't tucked into main.html:\n%s", page)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// templates and template names the current build executed, for -audit
+var rendered struct {
+	sync.Mutex
+	files map[string]bool
+	names map[string]bool
+}
+
+// static files that don't need a reference from any page
+var implicitStatic = map[string]bool{
+	"robots.txt":  true,
+	"favicon.ico": true,
+	"CNAME":       true,
+}
+
+// outputs searched for references to static files
+var referencingExts = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".xml":  true,
+	".json": true,
+}
+
+var defineNamePattern = regexp.MustCompile(`{{-?\s*(?:define|block)\s+"([^"]+)"`)
+
+// forget what previous builds rendered
+func resetAudit() {
+	rendered.Lock()
+	rendered.files = make(map[string]bool)
+	rendered.names = make(map[string]bool)
+	rendered.Unlock()
+}
+
+// record tmplPath and every template reachable from tmpl through
+// {{ template }} actions as used
+func recordTemplate(tmplPath string, tmpl *template.Template) {
+	rendered.Lock()
+	defer rendered.Unlock()
+	if rendered.files == nil {
+		return
+	}
+	rendered.files[filepath.Clean(tmplPath)] = true
+	rendered.files[filepath.Clean(tmpl.Name())] = true
+
+	var walk func(node parse.Node)
+	visit := func(name string) {
+		if rendered.names[name] {
+			return
+		}
+		rendered.names[name] = true
+		if t := tmpl.Lookup(name); t != nil && t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.TemplateNode:
+			visit(n.Name)
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	visit(tmpl.Name())
+}
+
+// log the templates in TemplateDir and files in StaticDir nothing in the
+// build used. a static file counts as used when an output mentions its path.
+func reportUnused() error {
+	unused, err := unusedTemplates()
+	if err != nil {
+		return err
+	}
+	assets, err := unusedStatic()
+	if err != nil {
+		return err
+	}
+	unused = append(unused, assets...)
+
+	for _, path := range unused {
+		log.Warningf("Unused: %v", path)
+	}
+	if len(unused) == 0 {
+		log.Info("No unused templates or static files")
+	}
+	return nil
+}
+
+func unusedTemplates() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(config.TemplateDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	partials, err := filepath.Glob(filepath.Join(config.TemplateDir, "partials", "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	rendered.Lock()
+	defer rendered.Unlock()
+
+	var unused []string
+	for _, file := range files {
+		if !rendered.files[filepath.Clean(file)] {
+			unused = append(unused, file)
+		}
+	}
+	// partials are used through the templates they define
+	for _, file := range partials {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		used := false
+		for _, m := range defineNamePattern.FindAllSubmatch(data, -1) {
+			if rendered.names[string(m[1])] {
+				used = true
+			}
+		}
+		if !used {
+			unused = append(unused, file)
+		}
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
+
+func unusedStatic() ([]string, error) {
+	if _, err := os.Stat(config.StaticDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	// everything the build produced that can refer to a static file
+	var texts [][]byte
+	outputs.Lock()
+	for path := range outputs.paths {
+		if referencingExts[filepath.Ext(path)] {
+			if data, err := ioutil.ReadFile(path); err == nil {
+				texts = append(texts, data)
+			}
+		}
+	}
+	outputs.Unlock()
+
+	var unused []string
+	err := filepath.Walk(config.StaticDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(config.StaticDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if implicitStatic[rel] {
+			return nil
+		}
+
+		names := []string{rel}
+		if hashed, ok := assetManifest[rel]; ok {
+			names = append(names, hashed)
+		}
+		for _, text := range texts {
+			for _, name := range names {
+				if bytes.Contains(text, []byte(name)) {
+					return nil
+				}
+			}
+		}
+		unused = append(unused, path)
+		return nil
+	})
+	sort.Strings(unused)
+	return unused, err
+}
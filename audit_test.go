@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keidaa/llog"
+)
+
+// run a build with -audit, returning the unused paths it reported
+func auditBuild(t *testing.T) []string {
+	t.Helper()
+	*audit = true
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.WARNING)
+	err := build(true)
+	log = llog.New(ioutil.Discard, llog.ERROR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unused []string
+	for _, line := range strings.Split(logged.String(), "\n") {
+		if p := strings.TrimPrefix(line, "Unused: "); p != line {
+			unused = append(unused, p)
+		}
+	}
+	return unused
+}
+
+func TestAudit(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "partials", "unused.html"), `{{ define "unused" }}never{{ end }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "partials", "nested.html"), `{{ define "nested" }}{{ if .Title }}{{ template "deep" . }}{{ end }}{{ end }}{{ define "deep" }}deep{{ end }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `<link href="/css/site.css">{{ template "nested" . }}{{ .Content }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "orphan.html"), `orphan`)
+	writeFile(t, filepath.Join(config.StaticDir, "css", "site.css"), `body{background:url(../img/bg.png)}`)
+	writeFile(t, filepath.Join(config.StaticDir, "img", "bg.png"), "png")
+	writeFile(t, filepath.Join(config.StaticDir, "img", "orphan.png"), "png")
+	writeFile(t, filepath.Join(config.StaticDir, "favicon.ico"), "ico")
+	writeSource(t, "2020-01-01-post.md", "# Post\n\n![pic](/img/inline.png)\n")
+	writeFile(t, filepath.Join(config.StaticDir, "img", "inline.png"), "png")
+
+	reported := strings.Join(auditBuild(t), "\n")
+	for _, p := range []string{
+		filepath.Join(config.TemplateDir, "partials", "unused.html"),
+		filepath.Join(config.TemplateDir, "orphan.html"),
+		filepath.Join(config.StaticDir, "img", "orphan.png"),
+	} {
+		if !strings.Contains(reported, p) {
+			t.Errorf("%v not reported unused:\n%s", p, reported)
+		}
+	}
+	for _, p := range []string{
+		filepath.Join(config.TemplateDir, "partials", "nested.html"),
+		filepath.Join(config.TemplateDir, "post.html"),
+		filepath.Join(config.TemplateDir, "main.html"),
+		filepath.Join(config.StaticDir, "css", "site.css"),
+		filepath.Join(config.StaticDir, "img", "bg.png"),
+		filepath.Join(config.StaticDir, "img", "inline.png"),
+		filepath.Join(config.StaticDir, "favicon.ico"),
+	} {
+		if strings.Contains(reported, p+"\n") || strings.HasSuffix(reported, p) {
+			t.Errorf("%v reported unused:\n%s", p, reported)
+		}
+	}
+}
+
+func TestAuditOff(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.StaticDir, "orphan.png"), "png")
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.WARNING)
+	if err := build(true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logged.String(), "Unused") {
+		t.Errorf("unused files reported without -audit:\n%s", logged.String())
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// name of the build manifest inside OutputDir
+const buildCacheFile = ".buildcache.json"
+
+// source file state at the time its post was last written, keyed by source path
+type buildCache map[string]cacheEntry
+
+type cacheEntry struct {
+	ModTime time.Time
+	Output  string
+	Stamp   string // everything else the page depends on, see postStamp
+}
+
+// read the manifest left by the previous build, an unreadable one is ignored
+func loadBuildCache() buildCache {
+	cache := make(buildCache)
+
+	data, err := ioutil.ReadFile(filepath.Join(config.OutputDir, buildCacheFile))
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Warningf("Ignoring build cache: %v", err)
+		return make(buildCache)
+	}
+	return cache
+}
+
+// report whether post's source and everything else its page depends on are
+// unchanged and its output still exists
+func (c buildCache) fresh(post *Post) bool {
+	entry, ok := c[post.Source]
+	if !ok || entry.Output != post.Path() {
+		return false
+	}
+
+	info, err := os.Stat(post.Source)
+	if err != nil || !info.ModTime().Equal(entry.ModTime) {
+		return false
+	}
+	if stamp, err := postStamp(post); err != nil || stamp != entry.Stamp {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(config.OutputDir, filepath.FromSlash(entry.Output)))
+	return err == nil
+}
+
+// remember the current state of post's source
+func (c buildCache) record(post *Post) error {
+	info, err := os.Stat(post.Source)
+	if err != nil {
+		return err
+	}
+	stamp, err := postStamp(post)
+	if err != nil {
+		return err
+	}
+	c[post.Source] = cacheEntry{info.ModTime(), post.Path(), stamp}
+	return nil
+}
+
+// hash of what goes into post's page besides its own source: the templates
+// it renders with, the config, site data and the posts it links to
+func postStamp(post *Post) (string, error) {
+	h := sha256.New()
+	tmpl, err := templateStamp(postTemplate(post))
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(h, tmpl)
+
+	enc := json.NewEncoder(h)
+	if err := enc.Encode(config); err != nil {
+		return "", err
+	}
+	if err := enc.Encode(site); err != nil {
+		return "", err
+	}
+
+	// linked posts change with the contents of their sources, or when other
+	// posts come and go. merely touching a source leaves its neighbours alone.
+	var linked []*Post
+	for i := range post.RelatedPosts {
+		linked = append(linked, &post.RelatedPosts[i])
+	}
+	for i := range post.Translations {
+		linked = append(linked, &post.Translations[i])
+	}
+	linked = append(linked, post.Prev, post.Next, post.SeriesPrev, post.SeriesNext)
+	fmt.Fprintln(h, len(post.RelatedPosts), len(post.Translations), post.SeriesPosition, post.SeriesTotal)
+	for _, p := range linked {
+		if p == nil {
+			fmt.Fprintln(h, "-")
+			continue
+		}
+		var sum [sha256.Size]byte
+		if data, err := ioutil.ReadFile(p.Source); err == nil {
+			sum = sha256.Sum256(data)
+		}
+		fmt.Fprintln(h, p.Source, p.Path(), hex.EncodeToString(sum[:]))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c buildCache) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(filepath.Join(config.OutputDir, buildCacheFile), data)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keidaa/llog"
+)
+
+// run an incremental build, returning the names of the posts it rendered
+func incrementalBuild(t *testing.T) []string {
+	t.Helper()
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.INFO)
+	err := build(false)
+	log = llog.New(ioutil.Discard, llog.ERROR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved []string
+	for _, line := range strings.Split(logged.String(), "\n") {
+		if name := strings.TrimPrefix(line, "Saved post: "); name != line {
+			saved = append(saved, name)
+		}
+	}
+	sort.Strings(saved)
+	return saved
+}
+
+// set the modification time of name a bit later than it was
+func touch(t *testing.T, name string) {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cacheSite(t *testing.T) []string {
+	t.Helper()
+	testSite(t)
+	srcs := []string{
+		writeSource(t, "2020-01-01-a.md", "# A\n\nbody\n"),
+		writeSource(t, "2020-01-02-b.md", "# B\n\nbody\n"),
+		writeSource(t, "2020-01-03-c.md", "# C\n\nbody\n"),
+		writeSource(t, "2020-01-04-d.md", "# D\n\nbody\n"),
+	}
+	if saved := incrementalBuild(t); len(saved) != 4 {
+		t.Fatalf("first build rendered %v, want every post", saved)
+	}
+	return srcs
+}
+
+func TestBuildCacheTouch(t *testing.T) {
+	srcs := cacheSite(t)
+	if saved := incrementalBuild(t); len(saved) != 0 {
+		t.Errorf("unchanged build rendered %v", saved)
+	}
+
+	touch(t, srcs[1])
+	if saved := incrementalBuild(t); strings.Join(saved, ",") != "2020-01-02-b" {
+		t.Errorf("rendered %v, want just the touched post", saved)
+	}
+
+	// -force renders everything
+	if err := build(true); err != nil {
+		t.Fatal(err)
+	}
+	if saved := incrementalBuild(t); len(saved) != 0 {
+		t.Errorf("build after -force rendered %v", saved)
+	}
+}
+
+func TestBuildCacheMissingOutput(t *testing.T) {
+	cacheSite(t)
+	if err := os.Remove(filepath.Join(config.OutputDir, "c.html")); err != nil {
+		t.Fatal(err)
+	}
+	if saved := incrementalBuild(t); strings.Join(saved, ",") != "2020-01-03-c" {
+		t.Errorf("rendered %v, want the post whose output is gone", saved)
+	}
+}
+
+func TestBuildCacheTemplate(t *testing.T) {
+	cacheSite(t)
+	touch(t, filepath.Join(config.TemplateDir, "post.html"))
+	if saved := incrementalBuild(t); len(saved) != 4 {
+		t.Errorf("rendered %v after a template change, want every post", saved)
+	}
+
+	touch(t, filepath.Join(config.TemplateDir, "partials", "header.html"))
+	if saved := incrementalBuild(t); len(saved) != 4 {
+		t.Errorf("rendered %v after a partial change, want every post", saved)
+	}
+}
+
+func TestBuildCacheConfig(t *testing.T) {
+	cacheSite(t)
+	config.SiteTitle = "Renamed"
+	if saved := incrementalBuild(t); len(saved) != 4 {
+		t.Errorf("rendered %v after a config change, want every post", saved)
+	}
+}
+
+func TestBuildCacheNeighbours(t *testing.T) {
+	srcs := cacheSite(t)
+
+	// editing b changes the links of a and c
+	writeFile(t, srcs[1], "# B edited\n\nbody\n")
+	if saved := incrementalBuild(t); strings.Join(saved, ",") != "2020-01-01-a,2020-01-02-b,2020-01-03-c" {
+		t.Errorf("rendered %v, want b and its neighbours", saved)
+	}
+
+	// a new newest post becomes the next of d
+	writeSource(t, "2020-01-05-e.md", "# E\n\nbody\n")
+	if saved := incrementalBuild(t); strings.Join(saved, ",") != "2020-01-04-d,2020-01-05-e" {
+		t.Errorf("rendered %v, want the new post and its neighbour", saved)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// every file the current build wrote or left in place, for -clean
+var outputs struct {
+	sync.Mutex
+	paths map[string]bool
+}
+
+// mark path as produced by the current build
+func keepOutput(path string) {
+	outputs.Lock()
+	if outputs.paths != nil {
+		outputs.paths[filepath.Clean(path)] = true
+	}
+	outputs.Unlock()
+}
+
+// remove files under OutputDir the build didn't produce, along with
+// directories left empty. dotfiles such as the build cache are kept.
+func cleanStale() error {
+	var stale, dirs []string
+	err := filepath.Walk(config.OutputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != config.OutputDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+		} else if !outputs.paths[filepath.Clean(path)] {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range stale {
+		if *dryRun {
+			log.Infof("Would remove %v", path)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		log.Info("Removed stale " + path)
+	}
+
+	// deepest first, removing a directory that isn't empty fails harmlessly
+	if !*dryRun {
+		for i := len(dirs) - 1; i > 0; i-- {
+			os.Remove(dirs[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// report whether the output file at slash separated path p exists
+func outputExistsAt(t *testing.T, p string) bool {
+	t.Helper()
+	_, err := os.Stat(filepath.Join(config.OutputDir, filepath.FromSlash(p)))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestCleanStale(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-kept.md", "# Kept\n")
+	gone := writeSource(t, "old/2020-01-02-gone.md", "# Gone\n")
+	writeFile(t, filepath.Join(config.StaticDir, "css", "site.css"), "body{}")
+	testBuild(t)
+	if !outputExistsAt(t, "old/gone.html") {
+		t.Fatal("post not written")
+	}
+
+	// without -clean the orphan stays
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(config.OutputDir, ".hidden"), "dotfiles stay")
+	testBuild(t)
+	if !outputExistsAt(t, "old/gone.html") {
+		t.Error("orphan removed without -clean")
+	}
+
+	*clean = true
+	testBuild(t)
+	if outputExistsAt(t, "old/gone.html") || outputExistsAt(t, "old") {
+		t.Error("orphan or its empty directory left with -clean")
+	}
+	for _, p := range []string{"kept.html", "index.html", "rss.xml", "css/site.css", ".hidden", buildCacheFile} {
+		if !outputExistsAt(t, p) {
+			t.Errorf("%v removed by -clean", p)
+		}
+	}
+}
+
+func TestCleanStaleAfterFailedPage(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	gone := writeSource(t, "2020-01-02-gone.md", "# Gone\n")
+	testBuild(t)
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index left unwritten isn't stale, nothing is removed
+	writeFile(t, filepath.Join(config.TemplateDir, "recent.html"), "{{ .Nope }}")
+	*clean = true
+	if err := build(true); err == nil {
+		t.Fatal("build with a failing index template succeeded")
+	}
+	for _, p := range []string{"index.html", "gone.html"} {
+		if !outputExistsAt(t, p) {
+			t.Errorf("%v removed by -clean after a failed build", p)
+		}
+	}
+}
+
+func TestCleanStaleIncremental(t *testing.T) {
+	testSite(t)
+	config.CopySource = true
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+
+	// posts the cache skips are still outputs of the build
+	*clean = true
+	if saved := incrementalBuild(t); len(saved) != 0 {
+		t.Fatalf("rendered %v, want the cached post skipped", saved)
+	}
+	for _, p := range []string{"post.html", "post.md"} {
+		if !outputExistsAt(t, p) {
+			t.Errorf("%v of a cached post removed by -clean", p)
+		}
+	}
+}
+
+func TestCleanStaleDryRun(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+	writeFile(t, filepath.Join(config.OutputDir, "orphan.html"), "stale")
+
+	*clean, *dryRun = true, true
+	testBuild(t)
+	if !outputExistsAt(t, "orphan.html") {
+		t.Error("dry run removed a stale file")
+	}
+}
+
+func TestCleanStaleGzip(t *testing.T) {
+	testSite(t)
+	config.PrecompressGzip = true
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	writeSource(t, "2020-01-02-other.md", "# Other\n")
+	testBuild(t)
+
+	// the copies of cached posts aren't rewritten but still belong to the build
+	*clean = true
+	if saved := incrementalBuild(t); len(saved) != 0 {
+		t.Fatalf("rendered %v, want the cached posts skipped", saved)
+	}
+	for _, p := range []string{"post.html.gz", "other.html.gz", "index.html.gz"} {
+		if !outputExistsAt(t, p) {
+			t.Errorf("%v removed by -clean", p)
+		}
+	}
+
+	// copies no longer written are stale
+	config.PrecompressGzip = false
+	testBuild(t)
+	if outputExistsAt(t, "post.html.gz") {
+		t.Error("gzip copy left with -clean after PrecompressGzip was turned off")
+	}
+}
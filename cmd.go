@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// templates written by init
+//
+//go:embed templates/*.html templates/partials/*.html
+var defaultTemplates embed.FS
+
+// run the subcommand named by the first argument, reporting whether there
+// was one
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "new":
+		if len(args) != 2 {
+			return true, errors.New("Usage: instigator new \"Post title\"")
+		}
+		return true, newPost(args[1])
+	case "preview":
+		if len(args) != 2 {
+			return true, errors.New("Usage: instigator preview post.md")
+		}
+		return true, preview(args[1])
+	}
+	return true, fmt.Errorf("Unknown command %q", args[0])
+}
+
+// create a dated draft named after title in SourceDir, never overwriting an
+// existing file
+func newPost(title string) error {
+	slug := slugify(title)
+	if slug == "" {
+		return fmt.Errorf("Unable to make a file name from title %q", title)
+	}
+
+	now := time.Now().In(timezone)
+	fm, err := yaml.Marshal(struct {
+		Title string `yaml:"title"`
+		Date  string `yaml:"date"`
+		Draft bool   `yaml:"draft"`
+	}{title, now.Format(time.RFC3339), true})
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(config.SourceDir, now.Format("2006-01-02")+"-"+slug+config.SourceExtensions[0])
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("%v already exists", name)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "---\n%s---\n\n", fm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	log.Info("Created " + name)
+	return nil
+}
+
+// settings written to the config file by init
+type initConfig struct {
+	SourceDir   string
+	TemplateDir string
+	OutputDir   string
+	StaticDir   string
+	SiteTitle   string
+	BaseURL     string
+}
+
+// set up a site in the current directory: a config file in format, json or
+// toml, the default templates and an empty source directory. existing files
+// are kept and reported.
+func initSite(format string) error {
+	defaults := initConfig{"content", "templates", "public", "static", defaultSiteTitle, ""}
+
+	files := make(map[string][]byte)
+	switch format {
+	case "", "json":
+		data, err := json.MarshalIndent(defaults, "", "\t")
+		if err != nil {
+			return err
+		}
+		files["config.json"] = append(data, '\n')
+	case "toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(defaults); err != nil {
+			return err
+		}
+		files["config.toml"] = buf.Bytes()
+	default:
+		return fmt.Errorf("Unknown config format %q, expected json or toml", format)
+	}
+
+	err := fs.WalkDir(defaultTemplates, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := defaultTemplates.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.FromSlash(path)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(defaults.SourceDir, 0755); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := files[name]
+		if _, err := os.Stat(name); err == nil {
+			log.Warningf("%v already exists, leaving it as it is", name)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			return err
+		}
+		log.Info("Created " + name)
+	}
+	return nil
+}
+
+// render the source file at name with its post template to w, without
+// writing anything to OutputDir
+func renderOne(name string, w io.Writer) error {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	post, err := parseSourceFile(abs)
+	if err != nil {
+		return err
+	}
+	if err := loadSite(); err != nil {
+		return err
+	}
+	out, err := renderPost(post)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// render the source file at name to a temporary html file and open it in
+// the default browser. root relative links won't resolve from there.
+func preview(name string) error {
+	path, err := renderTemp(name)
+	if err != nil {
+		return err
+	}
+	if err := openBrowser("file://" + filepath.ToSlash(path)); err != nil {
+		return fmt.Errorf("Unable to open %v: %v", path, err)
+	}
+	log.Infof("Opened preview of %v at %v", name, path)
+	return nil
+}
+
+// render the source file at name to a new temporary html file, returning
+// its path
+func renderTemp(name string) (string, error) {
+	f, err := ioutil.TempFile("", "instigator-preview-*.html")
+	if err != nil {
+		return "", err
+	}
+	if err := renderOne(name, f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// open url in the default browser without waiting for it, a variable so it
+// can be swapped out
+var openBrowser = func(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
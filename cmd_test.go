@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keidaa/llog"
+)
+
+func TestNewPost(t *testing.T) {
+	testSite(t)
+	if err := os.MkdirAll(config.SourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Add(-time.Second)
+	if err := newPost("Hello, New World!"); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(config.SourceDir, time.Now().In(timezone).Format("2006-01-02")+"-hello-new-world.md")
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm, body, err := parseFrontMatter(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.Title != "Hello, New World!" || !fm.Draft || strings.TrimSpace(string(body)) != "" {
+		t.Errorf("front matter = %+v, body %q", fm, body)
+	}
+	if d, err := parseFrontMatterDate(fm.Date); err != nil || d.Before(before) || d.After(time.Now()) {
+		t.Errorf("date = %q, %v, want the current time", fm.Date, err)
+	}
+
+	// the new post is a draft the build leaves out
+	post, err := parseSourceFile(name)
+	if err != nil || !post.Draft || post.Title != "Hello, New World!" {
+		t.Errorf("parsed %+v, %v", post, err)
+	}
+
+	// existing files are kept
+	if err := os.WriteFile(name, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newPost("Hello New World"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("error = %v, want the file reported as existing", err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "mine" {
+		t.Errorf("existing file overwritten with %q", data)
+	}
+}
+
+func TestNewPostUntitled(t *testing.T) {
+	testSite(t)
+	if err := newPost("!!!"); err == nil {
+		t.Error("no error for a title without a file name")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	testSite(t)
+	if ran, err := runCommand(nil); ran || err != nil {
+		t.Errorf("no arguments ran a command: %v, %v", ran, err)
+	}
+	for _, args := range [][]string{{"new"}, {"new", "a", "b"}, {"preview"}, {"publish"}} {
+		if ran, err := runCommand(args); !ran || err == nil {
+			t.Errorf("%v: ran %v, error %v, want an error", args, ran, err)
+		}
+	}
+}
+
+func TestInitSite(t *testing.T) {
+	for _, format := range []string{"json", "toml"} {
+		t.Run(format, func(t *testing.T) {
+			testConfig(t)
+			t.Chdir(t.TempDir())
+			if err := initSite(format); err != nil {
+				t.Fatal(err)
+			}
+
+			// the config reads back and the templates parse
+			name := "config." + format
+			if err := readConfig(name); err != nil {
+				t.Fatal(err)
+			}
+			if config.SourceDir != "content" || config.TemplateDir != "templates" || config.OutputDir != "public" {
+				t.Errorf("config = %+v", config)
+			}
+			if err := config.resolve(); err != nil {
+				t.Fatal(err)
+			}
+			if err := validateTemplates(); err != nil {
+				t.Error(err)
+			}
+			for _, p := range requiredTemplates {
+				if _, err := os.Stat(filepath.Join("templates", p)); err != nil {
+					t.Errorf("%v not created: %v", p, err)
+				}
+			}
+
+			// a site that builds right away
+			writeSource(t, "2020-01-01-first.md", "# First\n")
+			testBuild(t)
+			readOutput(t, "first.html")
+		})
+	}
+}
+
+func TestInitSiteExisting(t *testing.T) {
+	testConfig(t)
+	t.Chdir(t.TempDir())
+	writeFile(t, "config.json", `{"SiteTitle": "Mine"}`)
+	writeFile(t, filepath.Join("templates", "main.html"), "mine")
+
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.WARNING)
+	if err := initSite(""); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"config.json", filepath.Join("templates", "main.html")} {
+		if !strings.Contains(logged.String(), name+" already exists") {
+			t.Errorf("%v not reported as existing:\n%s", name, logged.String())
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join("templates", "main.html")); string(data) != "mine" {
+		t.Errorf("main.html overwritten with %q", data)
+	}
+	if _, err := os.Stat(filepath.Join("templates", "recent.html")); err != nil {
+		t.Errorf("missing templates not created: %v", err)
+	}
+
+	if err := initSite("yaml"); err == nil {
+		t.Error("no error for an unknown config format")
+	}
+}
+
+func TestRenderOne(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `<h1>{{ .Title }}</h1>{{ .Content }}`)
+	name := writeSource(t, "2020-01-01-sample.md", "---\ntitle: Sample\n---\nSome *text*.\n")
+
+	var out bytes.Buffer
+	if err := renderOne(name, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "<h1>Sample</h1><p>Some <em>text</em>.</p>\n"; got != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+	if _, err := os.Stat(config.OutputDir); !os.IsNotExist(err) {
+		t.Errorf("OutputDir touched: %v", err)
+	}
+
+	// relative to the working directory like other arguments
+	t.Chdir(config.SourceDir)
+	out.Reset()
+	if err := renderOne("2020-01-01-sample.md", &out); err != nil || !strings.Contains(out.String(), "Sample") {
+		t.Errorf("relative name rendered %q, %v", out.String(), err)
+	}
+
+	if err := renderOne("missing.md", &out); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+// run main with -render in a directory without a config file. the test binary
+// runs itself with INSTIGATOR_TEST_MAIN set to get a stdout of its own.
+func TestRenderMain(t *testing.T) {
+	if os.Getenv("INSTIGATOR_TEST_MAIN") != "" {
+		os.Args = []string{"instigator", "-render", "content/2020-01-01-sample.md"}
+		main()
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "templates", "post.html"), `<h1>{{ .Title }}</h1>{{ .Content }}`)
+	writeFile(t, filepath.Join(dir, "content", "2020-01-01-sample.md"), "---\ntitle: Sample\n---\nSome *text*.\n")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRenderMain$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "INSTIGATOR_TEST_MAIN=1")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.Bytes())
+	}
+	if got, want := stdout.String(), "<h1>Sample</h1><p>Some <em>text</em>.</p>\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if !strings.Contains(stderr.String(), "No config file found") {
+		t.Errorf("config warning not on stderr:\n%s", stderr.Bytes())
+	}
+}
+
+// replace openBrowser for the test, returning the urls it was asked to open
+func mockBrowser(t *testing.T, err error) *[]string {
+	t.Helper()
+	var opened []string
+	original := openBrowser
+	openBrowser = func(url string) error {
+		opened = append(opened, url)
+		return err
+	}
+	t.Cleanup(func() { openBrowser = original })
+	return &opened
+}
+
+func TestPreview(t *testing.T) {
+	testSite(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `<h1>{{ .Title }}</h1>{{ .Content }}`)
+	name := writeSource(t, "2020-01-01-sample.md", "---\ntitle: Sample\n---\nPreview *me*.\n")
+	opened := mockBrowser(t, nil)
+
+	if err := preview(name); err != nil {
+		t.Fatal(err)
+	}
+	if len(*opened) != 1 || !strings.HasPrefix((*opened)[0], "file://") {
+		t.Fatalf("opened %v, want one file url", *opened)
+	}
+	file := filepath.FromSlash(strings.TrimPrefix((*opened)[0], "file://"))
+	if !strings.HasSuffix(file, ".html") {
+		t.Errorf("preview file %v isn't html", file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "<h1>Sample</h1><p>Preview <em>me</em>.</p>\n"; got != want {
+		t.Errorf("preview = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(config.OutputDir); !os.IsNotExist(err) {
+		t.Errorf("OutputDir touched: %v", err)
+	}
+}
+
+func TestPreviewErrors(t *testing.T) {
+	testSite(t)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	opened := mockBrowser(t, errors.New("no browser"))
+
+	// nothing left behind for a file that doesn't render
+	if err := preview(filepath.Join(config.SourceDir, "missing.md")); err == nil {
+		t.Error("no error for a missing file")
+	}
+	if files, _ := os.ReadDir(tmp); len(files) != 0 || len(*opened) != 0 {
+		t.Errorf("left %d temporary files and opened %v", len(files), *opened)
+	}
+
+	name := writeSource(t, "2020-01-01-post.md", "# Post\n")
+	if err := preview(name); err == nil || !strings.Contains(err.Error(), "no browser") {
+		t.Errorf("error = %v, want the browser failure", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// upload OutputDir to the named target
+func deploy(target string) error {
+	switch target {
+	case "s3":
+		return deployS3()
+	case "ssh":
+		return deploySSH()
+	}
+	return fmt.Errorf("Unknown deploy target %q", target)
+}
+
+// the parts of the s3 api used for deploying
+type s3Client interface {
+	s3.ListObjectsV2APIClient
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+func deployS3() error {
+	if config.S3Bucket == "" {
+		return errors.New("Unable to deploy to s3: S3Bucket is not set")
+	}
+
+	ctx := context.Background()
+	var opts []func(*awsconfig.LoadOptions) error
+	if config.S3Region != "" {
+		opts = append(opts, awsconfig.WithRegion(config.S3Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("Unable to load aws config: %v", err)
+	}
+
+	return uploadS3(ctx, s3.NewFromConfig(cfg), config.S3Bucket, config.S3Prefix)
+}
+
+// upload files under OutputDir to bucket below prefix, skipping those whose
+// md5 matches the etag of the object already there
+func uploadS3(ctx context.Context, client s3Client, bucket, prefix string) error {
+	prefix = strings.Trim(prefix, "/")
+
+	// etags of the objects already uploaded
+	etags := make(map[string]string)
+	list := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		list.Prefix = aws.String(prefix + "/")
+	}
+	pages := s3.NewListObjectsV2Paginator(client, list)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("Unable to list s3://%v/%v: %v", bucket, prefix, err)
+		}
+		for _, obj := range page.Contents {
+			etags[aws.ToString(obj.Key)] = strings.Trim(aws.ToString(obj.ETag), `"`)
+		}
+	}
+
+	uploaded, unchanged := 0, 0
+	err := filepath.Walk(config.OutputDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// hidden files such as the build cache stay local
+		if strings.HasPrefix(info.Name(), ".") && p != config.OutputDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(config.OutputDir, p)
+		if err != nil {
+			return err
+		}
+		key := path.Join(prefix, filepath.ToSlash(rel))
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(data)
+		if etags[key] == hex.EncodeToString(sum[:]) {
+			unchanged++
+			return nil
+		}
+
+		if *dryRun {
+			log.Infof("Would upload %v to s3://%v/%v", rel, bucket, key)
+			uploaded++
+			return nil
+		}
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String(contentType(p)),
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to upload %v: %v", key, err)
+		}
+		log.Debugf("Uploaded %v", key)
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Uploaded %d files to s3://%v, %d unchanged", uploaded, bucket, unchanged)
+	return nil
+}
+
+func deploySSH() error {
+	if config.SSHHost == "" || config.SSHUser == "" || config.SSHKey == "" || config.SSHDir == "" {
+		return errors.New("Unable to deploy over ssh: SSHHost, SSHUser, SSHKey and SSHDir must be set")
+	}
+
+	key, err := ioutil.ReadFile(config.SSHKey)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("Unable to parse SSHKey %v: %v", config.SSHKey, err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return err
+	}
+
+	host := config.SSHHost
+	if !strings.Contains(host, ":") {
+		host += ":22"
+	}
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            config.SSHUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %v: %v", host, err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return uploadSFTP(client, config.SSHDir)
+}
+
+// upload files under OutputDir to dir on the remote, skipping those whose
+// size and modification time match the remote copy
+func uploadSFTP(client *sftp.Client, dir string) error {
+	uploaded, unchanged := 0, 0
+	err := filepath.Walk(config.OutputDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// hidden files such as the build cache stay local
+		if strings.HasPrefix(info.Name(), ".") && p != config.OutputDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(config.OutputDir, p)
+		if err != nil {
+			return err
+		}
+		dst := path.Join(dir, filepath.ToSlash(rel))
+
+		if info.IsDir() {
+			if *dryRun {
+				return nil
+			}
+			return client.MkdirAll(dst)
+		}
+
+		// unchanged since last upload, sftp keeps whole seconds
+		if remote, err := client.Stat(dst); err == nil && remote.Size() == info.Size() && remote.ModTime().Unix() == info.ModTime().Unix() {
+			unchanged++
+			return nil
+		}
+
+		if *dryRun {
+			log.Infof("Would upload %v to %v", rel, dst)
+			uploaded++
+			return nil
+		}
+		if err := uploadFile(client, p, dst, info); err != nil {
+			return fmt.Errorf("Unable to upload %v: %v", dst, err)
+		}
+		log.Debugf("Uploaded %v", dst)
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Uploaded %d files to %v:%v, %d unchanged", uploaded, config.SSHHost, dir, unchanged)
+	return nil
+}
+
+// copy src to dst on the remote, carrying over the modification time
+func uploadFile(client *sftp.Client, src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := client.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return client.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// content type for the file at p by its extension
+func contentType(p string) string {
+	if t := mime.TypeByExtension(filepath.Ext(p)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/keidaa/llog"
+	"github.com/pkg/sftp"
+)
+
+// in memory bucket recording the objects put in it
+type mockS3 struct {
+	objects map[string][]byte
+	types   map[string]string
+	puts    []string
+}
+
+func (m *mockS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for key, data := range m.objects {
+		sum := md5.Sum(data)
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(key), ETag: aws.String(`"` + hex.EncodeToString(sum[:]) + `"`)})
+	}
+	return out, nil
+}
+
+func (m *mockS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	key := aws.ToString(params.Key)
+	m.objects[key] = data
+	m.types[key] = aws.ToString(params.ContentType)
+	m.puts = append(m.puts, key)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestUploadS3(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.OutputDir, "index.html"), "<p>index</p>")
+	writeFile(t, filepath.Join(config.OutputDir, "rss.xml"), "<rss/>")
+	writeFile(t, filepath.Join(config.OutputDir, "img", "a.png"), "\x89PNG")
+	writeFile(t, filepath.Join(config.OutputDir, buildCacheFile), "{}")
+
+	client := &mockS3{
+		objects: map[string][]byte{
+			"blog/rss.xml":    []byte("<rss/>"),
+			"blog/index.html": []byte("<p>old</p>"),
+		},
+		types: make(map[string]string),
+	}
+	if err := uploadS3(context.Background(), client, "bucket", "/blog/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged and hidden files are skipped
+	sort.Strings(client.puts)
+	if want := []string{"blog/img/a.png", "blog/index.html"}; !reflect.DeepEqual(client.puts, want) {
+		t.Errorf("uploaded %v, want %v", client.puts, want)
+	}
+	if got := string(client.objects["blog/index.html"]); got != "<p>index</p>" {
+		t.Errorf("index.html uploaded as %q", got)
+	}
+	for key, want := range map[string]string{"blog/index.html": "text/html; charset=utf-8", "blog/img/a.png": "image/png"} {
+		if got := client.types[key]; got != want {
+			t.Errorf("content type of %v = %q, want %q", key, got, want)
+		}
+	}
+
+	// a second deploy has nothing to upload
+	client.puts = nil
+	if err := uploadS3(context.Background(), client, "bucket", "blog"); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.puts) != 0 {
+		t.Errorf("redeploy uploaded %v, want nothing", client.puts)
+	}
+}
+
+func TestUploadS3DryRun(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.OutputDir, "index.html"), "<p>index</p>")
+
+	*dryRun = true
+	client := &mockS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	if err := uploadS3(context.Background(), client, "bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.puts) != 0 {
+		t.Errorf("dry run uploaded %v", client.puts)
+	}
+}
+
+func TestDeployUnknownTarget(t *testing.T) {
+	testConfig(t)
+	if err := deploy("ftp"); err == nil {
+		t.Error("no error for an unknown deploy target")
+	}
+	if err := deploy("s3"); err == nil {
+		t.Error("no error for s3 without S3Bucket")
+	}
+	if err := deploy("ssh"); err == nil {
+		t.Error("no error for ssh without SSHHost")
+	}
+}
+
+// the server end of an in process sftp connection
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// sftp client connected to a server working on the local filesystem
+func testSFTP(t *testing.T) *sftp.Client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	server, err := sftp.NewServer(pipeConn{serverIn, serverOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientIn, clientOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+// names of the files uploadSFTP logged uploading
+func uploadedSFTP(t *testing.T, client *sftp.Client, dir string) []string {
+	t.Helper()
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.DEBUG)
+	err := uploadSFTP(client, dir)
+	log = llog.New(ioutil.Discard, llog.ERROR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploaded []string
+	for _, line := range strings.Split(logged.String(), "\n") {
+		if name := strings.TrimPrefix(line, "Uploaded "+dir+"/"); name != line {
+			uploaded = append(uploaded, name)
+		}
+	}
+	sort.Strings(uploaded)
+	return uploaded
+}
+
+func TestUploadSFTP(t *testing.T) {
+	testSite(t)
+	remote := filepath.ToSlash(t.TempDir())
+	client := testSFTP(t)
+	writeFile(t, filepath.Join(config.OutputDir, "index.html"), "<p>index</p>")
+	writeFile(t, filepath.Join(config.OutputDir, "posts", "a.html"), "<p>a</p>")
+	writeFile(t, filepath.Join(config.OutputDir, buildCacheFile), "{}")
+
+	// new files land in newly created directories
+	if got, want := uploadedSFTP(t, client, remote), []string{"index.html", "posts/a.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uploaded %v, want %v", got, want)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(remote, "posts", "a.html")); err != nil || string(data) != "<p>a</p>" {
+		t.Errorf("remote posts/a.html = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(remote, buildCacheFile)); !os.IsNotExist(err) {
+		t.Error("build cache uploaded")
+	}
+
+	// unchanged files are skipped
+	if got := uploadedSFTP(t, client, remote); len(got) != 0 {
+		t.Errorf("redeploy uploaded %v, want nothing", got)
+	}
+
+	// a changed size or modification time uploads the file again
+	writeFile(t, filepath.Join(config.OutputDir, "index.html"), "<p>new index</p>")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(config.OutputDir, "posts", "a.html"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uploadedSFTP(t, client, remote), []string{"index.html", "posts/a.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uploaded %v, want %v", got, want)
+	}
+}
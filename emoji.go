@@ -0,0 +1,81 @@
+package main
+
+import "regexp"
+
+// emoji by shortcode name, a common subset of the github and slack names
+var emoji = map[string]string{
+	"+1":               "👍",
+	"-1":               "👎",
+	"100":              "💯",
+	"angry":            "😠",
+	"beer":             "🍺",
+	"blush":            "😊",
+	"book":             "📖",
+	"bug":              "🐛",
+	"bulb":             "💡",
+	"cake":             "🍰",
+	"check":            "✔️",
+	"clap":             "👏",
+	"coffee":           "☕",
+	"confused":         "😕",
+	"cry":              "😢",
+	"eyes":             "👀",
+	"fire":             "🔥",
+	"frowning":         "😦",
+	"grin":             "😁",
+	"grinning":         "😀",
+	"heart":            "❤️",
+	"heart_eyes":       "😍",
+	"joy":              "😂",
+	"laughing":         "😆",
+	"link":             "🔗",
+	"lock":             "🔒",
+	"memo":             "📝",
+	"muscle":           "💪",
+	"ok_hand":          "👌",
+	"party":            "🥳",
+	"pencil":           "📝",
+	"point_right":      "👉",
+	"pray":             "🙏",
+	"question":         "❓",
+	"rocket":           "🚀",
+	"sad":              "😞",
+	"scream":           "😱",
+	"see_no_evil":      "🙈",
+	"shrug":            "🤷",
+	"slightly_smiling": "🙂",
+	"smile":            "😄",
+	"smiley":           "😃",
+	"smirk":            "😏",
+	"sob":              "😭",
+	"sparkles":         "✨",
+	"star":             "⭐",
+	"sunglasses":       "😎",
+	"sweat_smile":      "😅",
+	"tada":             "🎉",
+	"thinking":         "🤔",
+	"thumbsdown":       "👎",
+	"thumbsup":         "👍",
+	"warning":          "⚠️",
+	"wave":             "👋",
+	"wink":             "😉",
+	"wrench":           "🔧",
+	"x":                "❌",
+	"zap":              "⚡",
+}
+
+// code spans and blocks, which keep their shortcodes, or a shortcode
+var emojiPattern = regexp.MustCompile(`(?is)<pre\b.*?</pre>|<code\b.*?</code>|:[a-z0-9_+-]+:`)
+
+// replace known emoji shortcodes in rendered html, except inside code
+func replaceEmoji(data []byte) []byte {
+	return emojiPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		if m[0] == '<' {
+			return m
+		}
+		if e, ok := emoji[string(m[1:len(m)-1])]; ok {
+			return []byte(e)
+		}
+		return m
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const emojiSource = "Hello :smile: and :+1::tada:, but not :nosuchemoji: or 10:30:45.\n\n" +
+	"Inline `:smile:` stays.\n\n```\nfenced :smile:\n```\n\n    indented :heart:\n"
+
+func TestReplaceEmoji(t *testing.T) {
+	for in, want := range map[string]string{
+		"<p>:smile:</p>":                   "<p>😄</p>",
+		"<p>:SMILE: :smile</p>":            "<p>:SMILE: :smile</p>",
+		"<p>:+1::-1:</p>":                  "<p>👍👎</p>",
+		"<code>:smile:</code> :smile:":     "<code>:smile:</code> 😄",
+		"<pre lang=\"x\">\n:tada:\n</pre>": "<pre lang=\"x\">\n:tada:\n</pre>",
+	} {
+		if got := string(replaceEmoji([]byte(in))); got != want {
+			t.Errorf("replaceEmoji(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEmoji(t *testing.T) {
+	testSite(t)
+	post, err := parseSourceFile(writeSource(t, "2020-01-01-post.md", emojiSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(post.Content, "😄") {
+		t.Errorf("shortcodes converted without Emoji:\n%s", post.Content)
+	}
+
+	config.Emoji = true
+	post, err = parseSourceFile(writeSource(t, "2020-01-01-post.md", emojiSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Hello 😄 and 👍🎉, but not :nosuchemoji: or 10:30:45.",
+		"<code>:smile:</code>",
+		"fenced :smile:",
+		"indented :heart:",
+	} {
+		if !strings.Contains(post.Content, want) {
+			t.Errorf("content lacks %v:\n%s", want, post.Content)
+		}
+	}
+}
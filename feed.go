@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// number of posts in a feed when FeedLimit is unset
+const defaultFeedLimit = 20
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	XMLNSAtom string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Author      string `xml:"author,omitempty"`
+	Description cdata  `xml:"description"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// what feeds carry of post, the whole html with FeedFullContent and the
+// plain text excerpt otherwise
+func (p Post) FeedContent() string {
+	if config.FeedFullContent {
+		return p.Content
+	}
+	return p.Excerpt
+}
+
+// newest posts, capped at FeedLimit
+func feedPosts(posts Posts) Posts {
+	sort.Sort(posts)
+
+	limit := config.FeedLimit
+	if limit <= 0 {
+		limit = defaultFeedLimit
+	}
+	if len(posts) > limit {
+		return posts[:limit]
+	}
+	return posts
+}
+
+// build an rss 2.0 document for posts, selfURL being where the feed is served
+func buildRSS(title, link, selfURL, description string, posts Posts) ([]byte, error) {
+	posts = feedPosts(posts)
+
+	channel := rssChannel{
+		Title:       title,
+		Link:        link,
+		Description: description,
+		Self:        atomLink{Rel: "self", Href: selfURL, Type: "application/rss+xml"},
+	}
+	if len(posts) > 0 {
+		channel.LastBuildDate = posts[0].Date.Format(time.RFC1123Z)
+	}
+
+	for _, post := range posts {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       post.Title,
+			Link:        post.URL(),
+			GUID:        post.URL(),
+			PubDate:     post.Date.Format(time.RFC1123Z),
+			Author:      rssAuthor(post),
+			Description: cdata{post.FeedContent()},
+		})
+	}
+
+	out, err := xml.MarshalIndent(rssFeed{Version: "2.0", XMLNSAtom: "http://www.w3.org/2005/Atom", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+// rss wants an email address for authors, optionally followed by the name
+func rssAuthor(post Post) string {
+	if post.AuthorEmail == "" {
+		return ""
+	}
+	if post.Author == "" {
+		return post.AuthorEmail
+	}
+	return fmt.Sprintf("%v (%v)", post.AuthorEmail, post.Author)
+}
+
+func writeRSS(posts Posts) error {
+	out, err := buildRSS(config.SiteTitle, config.BaseURL+"/", config.BaseURL+"/rss.xml", "feed for "+config.SiteTitle, posts)
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutputFile(filepath.Join(config.OutputDir, "rss.xml"), out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published"`
+	Author    *atomAuthor  `xml:"author,omitempty"`
+	Links     []atomLink   `xml:"link"`
+	Summary   string       `xml:"summary,omitempty"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// build an atom 1.0 document for posts, selfURL being where the feed is served
+func buildAtom(title, selfURL string, posts Posts) ([]byte, error) {
+	posts = feedPosts(posts)
+
+	feed := atomFeed{
+		Title:  title,
+		ID:     selfURL,
+		Author: atomAuthor{Name: title},
+		Links: []atomLink{
+			{Rel: "self", Href: selfURL, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: config.BaseURL + "/", Type: "text/html"},
+		},
+	}
+
+	// feed is as recent as its newest entry
+	if len(posts) > 0 {
+		feed.Updated = posts[0].Date.Format(time.RFC3339)
+	} else {
+		feed.Updated = time.Now().Format(time.RFC3339)
+	}
+
+	for _, post := range posts {
+		var author *atomAuthor
+		if post.Author != "" {
+			author = &atomAuthor{post.Author, post.AuthorEmail}
+		}
+
+		// summary alone without FeedFullContent
+		var content *atomContent
+		if config.FeedFullContent {
+			content = &atomContent{"html", post.Content}
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     post.Title,
+			ID:        post.URL(),
+			Updated:   post.Date.Format(time.RFC3339),
+			Published: post.Date.Format(time.RFC3339),
+			Author:    author,
+			Links:     []atomLink{{Rel: "alternate", Href: post.URL(), Type: "text/html"}},
+			Summary:   post.Excerpt,
+			Content:   content,
+		})
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+func writeAtom(posts Posts) error {
+	out, err := buildAtom(config.SiteTitle, config.BaseURL+"/atom.xml", posts)
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutputFile(filepath.Join(config.OutputDir, "atom.xml"), out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// write an rss feed of the posts filed under term to <taxonomy>/<slug>/feed.xml
+func writeTermFeed(taxonomy, term string, posts Posts) error {
+	title := config.SiteTitle + ": " + term
+	description := fmt.Sprintf("posts in %v %v on %v", taxonomy, term, config.SiteTitle)
+	out, err := buildRSS(title, termURL(taxonomy, term), termFeedURL(taxonomy, term), description, posts)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, taxonomy, slugify(term), "feed.xml"), out)
+}
+
+// absolute url of the rss feed for term
+func termFeedURL(taxonomy, term string) string {
+	return config.BaseURL + "/" + taxonomy + "/" + slugify(term) + "/feed.xml"
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// build a json feed 1.1 document for posts
+func buildJSONFeed(title, selfURL string, posts Posts) ([]byte, error) {
+	posts = feedPosts(posts)
+
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       title,
+		HomePageURL: config.BaseURL + "/",
+		FeedURL:     selfURL,
+		Items:       make([]jsonFeedItem, 0, len(posts)),
+	}
+
+	for _, post := range posts {
+		item := jsonFeedItem{
+			ID:            post.URL(),
+			URL:           post.URL(),
+			Title:         post.Title,
+			Summary:       post.Excerpt,
+			DatePublished: post.Date.Format(time.RFC3339),
+			Tags:          post.Tags,
+		}
+		if post.Author != "" {
+			item.Authors = []jsonFeedAuthor{{post.Author}}
+		}
+		if config.FeedFullContent {
+			item.ContentHTML = post.Content
+		} else {
+			item.ContentText = post.Excerpt
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
+
+func writeJSONFeed(posts Posts) error {
+	out, err := buildJSONFeed(config.SiteTitle, config.BaseURL+"/feed.json", posts)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, "feed.json"), out)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// n posts a day apart, the oldest first
+func testPosts(n int) Posts {
+	var posts Posts
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		posts = append(posts, Post{
+			Name:    fmt.Sprintf("post%d", i),
+			Slug:    fmt.Sprintf("post%d", i),
+			Title:   fmt.Sprintf("Post %d", i),
+			Date:    start.AddDate(0, 0, i),
+			Content: fmt.Sprintf("<p>content %d</p>", i),
+			Excerpt: fmt.Sprintf("excerpt %d", i),
+		})
+	}
+	return posts
+}
+
+func TestRSS(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+
+	out, err := buildRSS("Site", "http://example.com/", "http://example.com/rss.xml", "feed", testPosts(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed rssFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("invalid rss: %v\n%s", err, out)
+	}
+	if feed.Version != "2.0" {
+		t.Errorf("version = %q", feed.Version)
+	}
+
+	items := feed.Channel.Items
+	if len(items) != defaultFeedLimit {
+		t.Fatalf("%d items, want %d", len(items), defaultFeedLimit)
+	}
+	for i, item := range items {
+		if want := fmt.Sprintf("Post %d", 24-i); item.Title != want {
+			t.Errorf("item %d is %q, want %q", i, item.Title, want)
+		}
+		date, err := time.Parse(time.RFC1123Z, item.PubDate)
+		if err != nil {
+			t.Errorf("pubDate %q isn't RFC1123Z: %v", item.PubDate, err)
+		} else if i > 0 && !date.Before(mustParseRSSDate(t, items[i-1].PubDate)) {
+			t.Errorf("item %d isn't older than the one before", i)
+		}
+	}
+	if got, want := items[0].Link, "http://example.com/post24.html"; got != want {
+		t.Errorf("link = %q, want %q", got, want)
+	}
+	if !strings.Contains(string(out), "<![CDATA[<p>content 24</p>]]>") {
+		t.Errorf("description isn't wrapped in CDATA:\n%s", out)
+	}
+}
+
+func mustParseRSSDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(time.RFC1123Z, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRSSFeedLimit(t *testing.T) {
+	testConfig(t)
+	config.FeedLimit = 3
+	config.FeedFullContent = false
+
+	out, err := buildRSS("Site", "/", "/rss.xml", "feed", testPosts(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed rssFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Channel.Items) != 3 {
+		t.Errorf("%d items, want 3", len(feed.Channel.Items))
+	}
+	// excerpts only without FeedFullContent
+	if got := feed.Channel.Items[0].Description.Value; got != "excerpt 4" {
+		t.Errorf("description = %q, want the excerpt", got)
+	}
+}
+
+func TestRSSEscaping(t *testing.T) {
+	testConfig(t)
+
+	posts := testPosts(1)
+	posts[0].Title = `Fish & <Chips> "quoted"`
+	posts[0].Content = "<p>a ]]> b & c</p>"
+	out, err := buildRSS("Tom & Jerry", "/", "/rss.xml", "feed", posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "<Chips>") || !strings.Contains(string(out), "Fish &amp; &lt;Chips&gt;") {
+		t.Errorf("title isn't escaped:\n%s", out)
+	}
+
+	var feed rssFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("invalid rss: %v\n%s", err, out)
+	}
+	if feed.Channel.Title != "Tom & Jerry" {
+		t.Errorf("channel title = %q", feed.Channel.Title)
+	}
+	item := feed.Channel.Items[0]
+	if item.Title != posts[0].Title || item.Description.Value != posts[0].Content {
+		t.Errorf("got title %q and description %q back", item.Title, item.Description.Value)
+	}
+}
+
+func TestAtomUpdated(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+
+	// newest post in the middle, feeds sort on their own
+	posts := testPosts(3)
+	newest := time.Date(2021, 6, 1, 8, 30, 0, 0, time.FixedZone("", 2*3600))
+	posts[1].Date = newest
+	out, err := buildAtom("Site", "http://example.com/atom.xml", posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("invalid atom: %v\n%s", err, out)
+	}
+	updated, err := time.Parse(time.RFC3339, feed.Updated)
+	if err != nil {
+		t.Fatalf("updated %q isn't RFC3339: %v", feed.Updated, err)
+	}
+	if !updated.Equal(newest) {
+		t.Errorf("feed updated %v, want the newest post's date %v", updated, newest)
+	}
+
+	if len(feed.Entries) != 3 || feed.Entries[0].Title != "Post 1" {
+		t.Fatalf("entries = %+v", feed.Entries)
+	}
+	entry := feed.Entries[0]
+	if entry.ID != "http://example.com/post1.html" || entry.Published != "2021-06-01T08:30:00+02:00" {
+		t.Errorf("entry id %q and published %q", entry.ID, entry.Published)
+	}
+	links := make(map[string]string)
+	for _, l := range feed.Links {
+		links[l.Rel] = l.Href
+	}
+	if links["self"] != "http://example.com/atom.xml" || links["alternate"] != "http://example.com/" {
+		t.Errorf("feed links = %v", links)
+	}
+}
+
+func TestFeedAuthors(t *testing.T) {
+	testConfig(t)
+	posts := testPosts(3)
+	posts[0].Author, posts[0].AuthorEmail = "Ann", "ann@example.com"
+	posts[1].Author = "Bob"
+
+	for i, want := range []string{"ann@example.com (Ann)", "", ""} {
+		if got := rssAuthor(posts[i]); got != want {
+			t.Errorf("rss author of %v = %q, want %q", posts[i].Author, got, want)
+		}
+	}
+
+	out, err := buildAtom("Site", "/atom.xml", posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(out, &feed); err != nil {
+		t.Fatal(err)
+	}
+	authors := make(map[string]*atomAuthor)
+	for _, e := range feed.Entries {
+		authors[e.Title] = e.Author
+	}
+	if a := authors["Post 0"]; a == nil || a.Name != "Ann" || a.Email != "ann@example.com" {
+		t.Errorf("atom author = %+v", a)
+	}
+	if a := authors["Post 1"]; a == nil || a.Name != "Bob" || a.Email != "" {
+		t.Errorf("atom author = %+v", a)
+	}
+	if a := authors["Post 2"]; a != nil {
+		t.Errorf("atom author = %+v, want none", a)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+	posts := testPosts(3)
+	posts[1].Author = "Ann"
+	posts[1].Tags = []string{"go"}
+
+	out, err := buildJSONFeed("Site", "http://example.com/feed.json", posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed map[string]interface{}
+	if err := json.Unmarshal(out, &feed); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, out)
+	}
+	for key, want := range map[string]string{
+		"version":       "https://jsonfeed.org/version/1.1",
+		"title":         "Site",
+		"home_page_url": "http://example.com/",
+		"feed_url":      "http://example.com/feed.json",
+	} {
+		if feed[key] != want {
+			t.Errorf("%v = %v, want %v", key, feed[key], want)
+		}
+	}
+
+	items, _ := feed["items"].([]interface{})
+	if len(items) != 3 {
+		t.Fatalf("%d items, want 3", len(items))
+	}
+	for i, raw := range items {
+		item := raw.(map[string]interface{})
+		n := 2 - i
+		if item["title"] != fmt.Sprintf("Post %d", n) {
+			t.Errorf("item %d is %v, want newest first", i, item["title"])
+		}
+		url := fmt.Sprintf("http://example.com/post%d.html", n)
+		if item["id"] != url || item["url"] != url || item["content_html"] != fmt.Sprintf("<p>content %d</p>", n) {
+			t.Errorf("item %d = %v", i, item)
+		}
+		if _, err := time.Parse(time.RFC3339, item["date_published"].(string)); err != nil {
+			t.Errorf("date_published: %v", err)
+		}
+	}
+	if authors := items[1].(map[string]interface{})["authors"]; fmt.Sprint(authors) != "[map[name:Ann]]" {
+		t.Errorf("authors = %v", authors)
+	}
+
+	// items stay a list with no posts
+	if out, err = buildJSONFeed("Site", "/feed.json", nil); err != nil || !strings.Contains(string(out), `"items": []`) {
+		t.Errorf("empty feed = %s, %v", out, err)
+	}
+}
+
+func TestFeedOptions(t *testing.T) {
+	testSite(t)
+	for i := 1; i <= 4; i++ {
+		writeSource(t, fmt.Sprintf("2020-01-0%d-post.md", i), fmt.Sprintf("---\ntitle: Post %d\n---\nIntro %d with **bold** words.\n", i, i))
+	}
+	feeds := map[string]string{"rss.xml": "<item>", "atom.xml": "<entry>", "feed.json": `"id":`}
+
+	// every post, whole
+	testBuild(t)
+	for p, item := range feeds {
+		got := readOutput(t, p)
+		if n := strings.Count(got, item); n != 4 {
+			t.Errorf("%v has %d items, want 4", p, n)
+		}
+		if !strings.Contains(got, "strong") {
+			t.Errorf("%v lacks the post html:\n%s", p, got)
+		}
+	}
+
+	// newest two, excerpts only
+	config.FeedLimit = 2
+	config.FeedFullContent = false
+	testBuild(t)
+	for p, item := range feeds {
+		got := readOutput(t, p)
+		if n := strings.Count(got, item); n != 2 {
+			t.Errorf("%v has %d items, want 2", p, n)
+		}
+		if !inOrder(got, "Post 4", "Post 3") || strings.Contains(got, "Post 2") {
+			t.Errorf("%v doesn't carry the newest posts:\n%s", p, got)
+		}
+		if strings.Contains(got, "strong") || !strings.Contains(got, "Intro 4 with bold words.") {
+			t.Errorf("%v doesn't carry just the excerpts:\n%s", p, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// name of the asset manifest inside OutputDir
+const assetManifestFile = "assets.json"
+
+// static files getting a content hash in their name with Fingerprint
+var fingerprintExts = map[string]bool{
+	".css": true,
+	".js":  true,
+}
+
+// slash separated paths relative to StaticDir mapped to their hashed names,
+// like css/style.css to css/style.1a2b3c4d.css
+var assetManifest map[string]string
+
+// work out hashed names for the css and js under StaticDir, reporting whether
+// they differ from the manifest the previous build left
+func fingerprintAssets() (bool, error) {
+	manifest := make(map[string]string)
+	if _, err := os.Stat(config.StaticDir); config.Fingerprint && err == nil {
+		err := filepath.Walk(config.StaticDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := filepath.Ext(path)
+			if info.IsDir() || !fingerprintExts[ext] {
+				return nil
+			}
+
+			rel, err := filepath.Rel(config.StaticDir, path)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			rel = filepath.ToSlash(rel)
+			manifest[rel] = strings.TrimSuffix(rel, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// manifest of the previous build, missing when it didn't fingerprint
+	previous := make(map[string]string)
+	if data, err := ioutil.ReadFile(filepath.Join(config.OutputDir, assetManifestFile)); err == nil {
+		json.Unmarshal(data, &previous)
+	}
+
+	changed := len(previous) != len(manifest)
+	for name, hashed := range manifest {
+		if previous[name] != hashed {
+			changed = true
+		}
+	}
+
+	assetManifest = manifest
+	return changed, nil
+}
+
+func writeAssetManifest() error {
+	data, err := json.MarshalIndent(assetManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(filepath.Join(config.OutputDir, assetManifestFile), data)
+}
+
+// value of a href or src attribute
+var assetLinkPattern = regexp.MustCompile(`\b((?:href|src)=["'])([^"']*)`)
+
+// point root relative and BaseURL links to fingerprinted assets at their
+// hashed names
+func fingerprintLinks(data []byte) []byte {
+	if len(assetManifest) == 0 {
+		return data
+	}
+	return assetLinkPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		parts := assetLinkPattern.FindSubmatch(m)
+		link := string(parts[2])
+
+		base := ""
+		if config.BaseURL != "" && strings.HasPrefix(link, config.BaseURL+"/") {
+			base = config.BaseURL
+		} else if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") {
+			return m
+		}
+
+		// keep any query or fragment
+		name := strings.TrimPrefix(link[len(base):], "/")
+		suffix := ""
+		if i := strings.IndexAny(name, "?#"); i >= 0 {
+			name, suffix = name[:i], name[i:]
+		}
+
+		hashed, ok := assetManifest[name]
+		if !ok {
+			return m
+		}
+		return []byte(string(parts[1]) + base + "/" + hashed + suffix)
+	})
+}
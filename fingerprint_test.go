@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the name fingerprinting gives the static file rel with data
+func hashedName(rel, data string) string {
+	sum := sha256.Sum256([]byte(data))
+	ext := filepath.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+func TestFingerprint(t *testing.T) {
+	testSite(t)
+	config.Fingerprint = true
+	writeFile(t, filepath.Join(config.StaticDir, "css", "site.css"), "body{}")
+	writeFile(t, filepath.Join(config.StaticDir, "app.js"), "run()")
+	writeFile(t, filepath.Join(config.StaticDir, "img", "a.png"), "\x89PNG")
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"),
+		`<link href="/css/site.css?v=1"><script src="{{ baseURL }}/app.js"></script><img src="/img/a.png"><a href="/css/other.css">`)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+
+	css, js := hashedName("css/site.css", "body{}"), hashedName("app.js", "run()")
+	for _, p := range []string{css, js, "img/a.png"} {
+		if !outputExistsAt(t, p) {
+			t.Errorf("%v not copied", p)
+		}
+	}
+	for _, p := range []string{"css/site.css", "app.js"} {
+		if outputExistsAt(t, p) {
+			t.Errorf("%v copied under its original name", p)
+		}
+	}
+
+	want := `<link href="/` + css + `?v=1"><script src="http://example.com/` + js + `"></script><img src="/img/a.png"><a href="/css/other.css">`
+	if got := readOutput(t, "post.html"); got != want {
+		t.Errorf("post page =\n%v\nwant\n%v", got, want)
+	}
+
+	var manifest map[string]string
+	if err := json.Unmarshal([]byte(readOutput(t, assetManifestFile)), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"css/site.css": css, "app.js": js}; !reflect.DeepEqual(manifest, want) {
+		t.Errorf("manifest = %v, want %v", manifest, want)
+	}
+}
+
+func TestFingerprintChanged(t *testing.T) {
+	testSite(t)
+	config.Fingerprint = true
+	style := filepath.Join(config.StaticDir, "site.css")
+	writeFile(t, style, "body{}")
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `<link href="/site.css">`)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	incrementalBuild(t)
+
+	// a new hash renders every page again, even with the posts cached
+	writeFile(t, style, "body{margin:0}")
+	if saved := incrementalBuild(t); len(saved) != 1 {
+		t.Errorf("rendered %v after an asset changed, want every post", saved)
+	}
+	if got, want := readOutput(t, "post.html"), `<link href="/`+hashedName("site.css", "body{margin:0}")+`">`; got != want {
+		t.Errorf("post page = %q, want %q", got, want)
+	}
+}
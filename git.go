@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// returned by gitCreated for files git doesn't know about
+var errNotTracked = errors.New("Not tracked by git")
+
+// author date of the commit that first added path. fails when git isn't
+// installed, path is outside a repository or hasn't been committed.
+func gitCreated(path string) (time.Time, error) {
+	cmd := exec.Command("git", "log", "--diff-filter=A", "--format=%aI", "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// newest first, so the first addition is the last line
+	lines := strings.Fields(string(out))
+	if len(lines) == 0 {
+		return time.Time{}, errNotTracked
+	}
+
+	d, err := time.Parse(time.RFC3339, lines[len(lines)-1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.In(timezone), nil
+}
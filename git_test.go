@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// run git in dir with a fixed identity and the given author date
+func runGit(t *testing.T, dir, date string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestGitCreated(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	testSite(t)
+	repo := config.SourceDir
+	runGit(t, repo, "", "init", "-q")
+
+	post := writeSource(t, "notes/undated.md", "# Undated\n")
+	runGit(t, repo, "2019-03-04T05:06:07+02:00", "add", ".")
+	runGit(t, repo, "2019-03-04T05:06:07+02:00", "commit", "-q", "-m", "add")
+
+	// later edits don't move the date
+	writeFile(t, post, "# Undated\n\nedited\n")
+	runGit(t, repo, "2020-01-01T00:00:00Z", "commit", "-q", "-am", "edit")
+
+	d, err := gitCreated(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2019, 3, 4, 3, 6, 7, 0, time.UTC)
+	if !d.Equal(want) {
+		t.Errorf("gitCreated = %v, want %v", d, want)
+	}
+
+	parsed, err := parseSourceFile(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Date.Equal(want) {
+		t.Errorf("post date = %v, want the commit date %v", parsed.Date, want)
+	}
+
+	// untracked files fall back to their modification time
+	untracked := writeSource(t, "untracked.md", "# Untracked\n")
+	if _, err := gitCreated(untracked); err != errNotTracked {
+		t.Errorf("error = %v, want errNotTracked", err)
+	}
+	mtime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(untracked, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err = parseSourceFile(untracked); err != nil {
+		t.Fatal(err)
+	} else if !parsed.Date.Equal(mtime) {
+		t.Errorf("untracked post date = %v, want %v", parsed.Date, mtime)
+	}
+}
+
+func TestGitCreatedOutsideRepo(t *testing.T) {
+	testConfig(t)
+	name := filepath.Join(t.TempDir(), "post.md")
+	writeFile(t, name, "# Post\n")
+	if _, err := gitCreated(name); err == nil {
+		t.Error("no error outside a repository")
+	}
+}
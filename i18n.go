@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// directory the post's outputs go below, its language when Languages is set
+func (p Post) langDir() string {
+	if len(config.Languages) == 0 {
+		return ""
+	}
+	return p.Lang
+}
+
+// language of a post from its front matter lang, or the top directory of
+// dir when that's a configured language, which is then dropped from dir.
+// posts without either are in the first of Languages.
+func postLang(lang, dir string) (string, string, error) {
+	if len(config.Languages) == 0 {
+		return lang, dir, nil
+	}
+
+	top, rest := dir, ""
+	if i := strings.Index(dir, "/"); i >= 0 {
+		top, rest = dir[:i], dir[i+1:]
+	}
+	if knownLang(top) && (lang == "" || lang == top) {
+		return top, rest, nil
+	}
+
+	if lang == "" {
+		return config.Languages[0], dir, nil
+	}
+	if !knownLang(lang) {
+		return "", "", fmt.Errorf("Unknown lang %q, expected one of %v", lang, strings.Join(config.Languages, ", "))
+	}
+	return lang, dir, nil
+}
+
+func knownLang(lang string) bool {
+	for _, l := range config.Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// position of lang in Languages, unknown ones last
+func langOrder(lang string) int {
+	for i, l := range config.Languages {
+		if l == lang {
+			return i
+		}
+	}
+	return len(config.Languages)
+}
+
+// set Translations on each post to the other posts with its TranslationKey,
+// in Languages order
+func linkTranslations(posts Posts) {
+	keys := make(map[string][]int)
+	for i := range posts {
+		posts[i].Translations = nil
+		if posts[i].TranslationKey != "" {
+			keys[posts[i].TranslationKey] = append(keys[posts[i].TranslationKey], i)
+		}
+	}
+
+	for _, group := range keys {
+		// copies, as with Prev and Next
+		translations := make(Posts, 0, len(group))
+		for _, i := range group {
+			translations = append(translations, posts[i])
+		}
+		sort.SliceStable(translations, func(a, b int) bool {
+			return langOrder(translations[a].Lang) < langOrder(translations[b].Lang)
+		})
+
+		for _, i := range group {
+			for _, t := range translations {
+				if t.Source != posts[i].Source {
+					posts[i].Translations = append(posts[i].Translations, t)
+				}
+			}
+		}
+	}
+}
+
+// posts in lang
+func postsIn(lang string, posts Posts) Posts {
+	var in Posts
+	for _, post := range posts {
+		if post.Lang == lang {
+			in = append(in, post)
+		}
+	}
+	return in
+}
+
+// write an index and rss feed below /<lang>/ for each of Languages
+func writeLanguages(posts Posts) error {
+	for _, lang := range config.Languages {
+		in := postsIn(lang, posts)
+		title := fmt.Sprintf("%v (%v)", config.SiteTitle, lang)
+
+		if err := writeIndexPages(lang, title, in); err != nil {
+			return err
+		}
+
+		link := pageURL(lang + "/index.html")
+		out, err := buildRSS(title, link, langFeedURL(lang), "feed for "+title, in)
+		if err != nil {
+			return err
+		}
+		if err := writeOutputFile(filepath.Join(config.OutputDir, lang, "rss.xml"), out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// absolute url of the rss feed for lang
+func langFeedURL(lang string) string {
+	return config.BaseURL + "/" + lang + "/rss.xml"
+}
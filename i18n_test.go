@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func languageSite(t *testing.T) {
+	t.Helper()
+	testSite(t)
+	config.Languages = []string{"en", "de"}
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `{{ .Lang }}:{{ range .Posts }}[{{ .Title }}]{{ end }}`)
+	writeSource(t, "en/2020-01-01-hello.md", "---\ntitle: Hello\ntranslationKey: hello\n---\nbody\n")
+	writeSource(t, "2020-01-02-weather.md", "---\ntitle: Weather\n---\nbody\n")
+	writeSource(t, "de/2020-01-01-hallo.md", "---\ntitle: Hallo\ntranslationKey: hello\n---\nText\n")
+	writeSource(t, "misc/2020-01-03-wetter.md", "---\ntitle: Wetter\nlang: de\n---\nText\n")
+}
+
+func TestLanguages(t *testing.T) {
+	languageSite(t)
+	testBuild(t)
+
+	// posts below their language, with an index and feed each
+	for _, p := range []string{"en/hello.html", "en/weather.html", "de/hallo.html", "de/misc/wetter.html"} {
+		if !outputExistsAt(t, p) {
+			t.Errorf("%v not written", p)
+		}
+	}
+	for p, want := range map[string]string{
+		"en/index.html": "en:[Weather][Hello]",
+		"de/index.html": "de:[Wetter][Hallo]",
+		"index.html":    ":[Wetter][Weather][Hallo][Hello]",
+	} {
+		if got := readOutput(t, p); got != want {
+			t.Errorf("%v = %q, want %q", p, got, want)
+		}
+	}
+	for p, want := range map[string][]string{"en/rss.xml": {"Hello", "Weather"}, "de/rss.xml": {"Hallo", "Wetter"}} {
+		feed := readOutput(t, p)
+		for _, title := range []string{"Hello", "Weather", "Hallo", "Wetter"} {
+			wanted := strings.Contains(strings.Join(want, ","), title)
+			if strings.Contains(feed, "<title>"+title+"</title>") != wanted {
+				t.Errorf("%v has %v: %v, want %v", p, title, !wanted, wanted)
+			}
+		}
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	languageSite(t)
+	testBuild(t)
+
+	if got := readOutput(t, "en/hello.html"); !strings.Contains(got, `<a href="http://example.com/de/hallo.html" hreflang="de" lang="de">Hallo</a>`) {
+		t.Errorf("en/hello.html lacks the switcher to German:\n%s", got)
+	}
+	if got := readOutput(t, "de/hallo.html"); !strings.Contains(got, `<a href="http://example.com/en/hello.html" hreflang="en" lang="en">Hello</a>`) {
+		t.Errorf("de/hallo.html lacks the switcher to English:\n%s", got)
+	}
+	if got := readOutput(t, "en/weather.html"); strings.Contains(got, `class="translations"`) {
+		t.Errorf("switcher on a post without translations:\n%s", got)
+	}
+}
+
+func TestPostLang(t *testing.T) {
+	testConfig(t)
+	if lang, dir, err := postLang("de", "de/sub"); err != nil || lang != "de" || dir != "de/sub" {
+		t.Errorf("postLang without Languages = %q, %q, %v", lang, dir, err)
+	}
+
+	config.Languages = []string{"en", "de"}
+	for _, tc := range []struct{ lang, dir, wantLang, wantDir string }{
+		{"", "", "en", ""},
+		{"", "de", "de", ""},
+		{"", "de/sub", "de", "sub"},
+		{"de", "de/sub", "de", "sub"},
+		{"de", "sub", "de", "sub"},
+		{"en", "de/sub", "en", "de/sub"},
+		{"", "misc", "en", "misc"},
+	} {
+		lang, dir, err := postLang(tc.lang, tc.dir)
+		if err != nil || lang != tc.wantLang || dir != tc.wantDir {
+			t.Errorf("postLang(%q, %q) = %q, %q, %v, want %q, %q", tc.lang, tc.dir, lang, dir, err, tc.wantLang, tc.wantDir)
+		}
+	}
+	if _, _, err := postLang("fr", ""); err == nil || !strings.Contains(err.Error(), "fr") {
+		t.Errorf("error = %v, want one naming the unknown language", err)
+	}
+}
@@ -3,287 +3,2386 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
-	"sort"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BurntSushi/toml"
 	"github.com/keidaa/llog"
-	"github.com/russross/blackfriday"
+	"gopkg.in/yaml.v2"
+)
+
+var log = llog.New(&syncWriter{w: os.Stdout}, llog.DEBUG)
+
+// writer serializing writes, so lines logged from concurrent workers don't
+// interleave. whole lines rely on llog writing each line in a single Write,
+// a line split over several writes can still be interleaved.
+type syncWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Write(p)
+}
+
+// returned by parseDate for names without a date
+var errNoDate = errors.New("Unable to find a date in filename")
+
+var datePattern = regexp.MustCompile(`(\d{1,4})-(\d{1,2})-(\d{1,2})`)
+
+// location of post dates, set from the Timezone config
+var timezone = time.UTC
+
+// marks the end of a post's excerpt in its markdown source
+const moreMarker = "<!--more-->"
+
+// used for the index, feeds and meta tags when SiteTitle is unset
+const defaultSiteTitle = "My Site"
+
+var (
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+	inlineTagPattern = regexp.MustCompile(`(?i)</?(?:a|abbr|b|code|del|em|i|ins|kbd|mark|q|s|small|span|strong|sub|sup|u)\b[^>]*>`)
+	headingPattern   = regexp.MustCompile(`(?s)<h[1-6][^>]*>.*?</h[1-6]>`)
+	paragraphPattern = regexp.MustCompile(`(?s)<p>.*?</p>`)
+)
+
+// command line flags
+var (
+	drafts      = flag.Bool("drafts", false, "include draft posts in the build")
+	future      = flag.Bool("future", false, "include posts dated in the future")
+	configFile  = flag.String("config", "", "config file (default config.toml or config.json)")
+	sourceDir   = flag.String("source", "", "override SourceDir")
+	templateDir = flag.String("template", "", "override TemplateDir")
+	outputDir   = flag.String("output", "", "override OutputDir")
+	force       = flag.Bool("force", false, "render all posts, ignoring the build cache")
+	watchMode   = flag.Bool("watch", false, "rebuild when sources or templates change")
+	serveMode   = flag.Bool("serve", false, "serve OutputDir over http, rebuilding and reloading on changes")
+	verbose     = flag.Bool("v", false, "log one level more verbosely than LogLevel")
+	dryRun      = flag.Bool("dryrun", false, "report what would be written without touching any files")
+	clean       = flag.Bool("clean", false, "remove files in the output dir no longer produced by the build")
+	deployTo    = flag.String("deploy", "", "upload the output after building, to s3 or ssh")
+	checkLinks  = flag.Bool("check", false, "fail the build on internal links to missing pages")
+	renderFile  = flag.String("render", "", "print the page for a single source file instead of building")
+	serveDrafts = flag.Bool("servedrafts", false, "with -serve, render drafts below /drafts/ without writing them")
+	audit       = flag.Bool("audit", false, "render every post and report templates and static files nothing used")
 )
 
-var log = llog.New(os.Stdout, llog.DEBUG)
+var config Config
 
-var config struct {
+type Config struct {
 	SourceDir,
 	TemplateDir,
-	OutputDir string
+	OutputDir,
+	StaticDir,
+	DataFile, // json for templates as .Site.Data, data.json by default
+	DataDir, // json files for templates as .Site.Data.<name>, data by default
+	SiteTitle,
+	BaseURL,
+	PathPrefix, // e.g. /blog when the site isn't served from the root
+	Timezone,
+	DefaultAuthor,
+	DefaultAuthorEmail,
+	DefaultImage,
+	Permalink, // e.g. /:year/:month/:slug/
+	DateFormat, // go layout or one of short, long, iso and rfc3339
+	SortBy, // date-desc, date-asc or title
+	LogLevel string // error, warning, info or debug
+	Host            string // interface -serve listens on, localhost unless set
+	Port            int
+	PerPage         int
+	FeedLimit       int
+	FeedFullContent bool // whole posts in feeds rather than excerpts, on by default
+	Concurrency     int
+	WordsPerMinute  int
+	RelatedCount    int
+	IndexTruncate   int // characters of text .IndexContent keeps, 0 for no limit
+	IndexParagraphs int // paragraphs and other blocks .IndexContent keeps, 0 for no limit
+	SearchIndexBody bool
+	AutoDatePrefix  bool // rename undated source files to start with today's date
+	Minify          bool
+	PrettyURLs      bool // write pages as <name>/index.html
+	StrictLinks     bool // fail the build on internal links to missing pages, like -check
+	StrictDates     bool // fail posts whose file name and front matter dates differ
+	CopySource      bool // write the markdown of posts next to their html
+	PrecompressGzip bool // write .gz copies of html, xml and json outputs
+	Fingerprint     bool // add a content hash to the names of static css and js
+
+	MarkdownExtensions []string
+	Footnotes          bool     // footnotes with return links and definition lists
+	Autolink           bool     // link bare urls and email addresses
+	Emoji              bool     // replace shortcodes like :smile: outside code
+	Math               bool     // pass $...$ and $$...$$ through untouched for mathjax or katex
+	SourceExtensions   []string // e.g. .md and .markdown
+	RobotsDisallow     []string // paths disallowed for every crawler in robots.txt
+
+	// globs of files and directories in SourceDir to leave out, relative to
+	// it. patterns without a slash match names at any depth, e.g. notes or
+	// *.draft.md.
+	Exclude []string
+
+	// language codes posts are written in, the first being the default for
+	// posts without a lang. with any set, each language gets its own index
+	// and feed and posts go below /<lang>/.
+	Languages []string
+
+	// taxonomy names mapped to the front matter key listing a post's terms,
+	// e.g. categories: category. tags is always one of them.
+	Taxonomies map[string]string
+
+	// chroma style for fenced code blocks, highlighting is off when empty.
+	// with HighlightClasses the style goes to highlight.css instead of inline.
+	HighlightStyle   string
+	HighlightClasses bool
+
+	// strip dangerous markup from rendered posts with the ugc or strict
+	// policy, ugc being the default. both drop inline styles, so highlighting
+	// needs HighlightClasses.
+	Sanitize       bool
+	SanitizePolicy string
+
+	// bucket, key prefix and region for -deploy=s3, the region falls back
+	// to the usual aws environment and shared config
+	S3Bucket,
+	S3Prefix,
+	S3Region string
+
+	// host[:port], user, private key and remote directory for -deploy=ssh.
+	// the host key has to be in ~/.ssh/known_hosts.
+	SSHHost,
+	SSHUser,
+	SSHKey,
+	SSHDir string
 }
 
 type Post struct {
+	Source,
 	Name,
+	Dir,
+	Slug,
 	Title,
-	Content string
-	Date time.Time
-}
+	Author,
+	AuthorEmail,
+	Layout,
+	Output, // file name overriding the output path, relative to Dir
+	Image,
+	Content,
+	Excerpt string
+	Date        time.Time
+	Modified    time.Time // last update, never before Date
+	Tags        []string
+	Terms       map[string][]string // by taxonomy, tags included
+	Draft       bool
+	Pinned      bool // listed first on the index
+	WordCount   int
+	CharCount   int // runes, not bytes
+	ReadingTime int // minutes
+	TOC         []*TOCEntry
 
-type Posts []Post
+	// front matter keys without a field of their own, {{ .Params.foo }}
+	Params map[string]interface{}
 
-func (p Posts) Len() int           { return len(p) }
-func (p Posts) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-func (p Posts) Less(i, j int) bool { return p[i].Date.After(p[j].Date) }
+	// chronologically adjacent posts, Next being the newer one
+	Prev, Next *Post
 
-// parse markdown file and convert to html
-func parseSourceFile(srcFilePath string) (*Post, error) {
-	post := &Post{}
+	// posts sharing the most tags with this one
+	RelatedPosts Posts
 
-	post.Name = trimPath(srcFilePath)
+	// series the post is part SeriesPart of, SeriesPosition being its 1 based
+	// place among the SeriesTotal posts of the series ordered by part
+	Series                      string
+	SeriesPart                  int
+	SeriesPosition, SeriesTotal int
+	SeriesPrev, SeriesNext      *Post
 
-	// date
-	d, err := parseDate(post.Name)
-	if err != nil {
-		log.Warning(err)
+	// language, and the posts sharing its TranslationKey in other languages
+	Lang           string
+	TranslationKey string
+	Translations   Posts
+}
+
+// slash separated output path of the post relative to OutputDir, following
+// the Permalink pattern if set. patterns ending in a slash give an index.html
+// inside that directory. an output file name in front matter wins over both.
+func (p Post) Path() string {
+	if dir := p.langDir(); dir != "" {
+		return path.Join(dir, p.localPath())
 	}
-	post.Date = d
+	return p.localPath()
+}
 
-	// read file
-	data, err := ioutil.ReadFile(srcFilePath)
-	if err != nil {
-		return nil, err
+// output path of the post within its language
+func (p Post) localPath() string {
+	if p.Output != "" {
+		return path.Join(p.Dir, p.Output)
+	}
+	if config.Permalink == "" {
+		return pagePath(path.Join(p.Dir, p.Slug))
 	}
 
-	// parse title from first headline
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if s := strings.TrimLeft(line, " "); strings.HasPrefix(s, "#") {
-			post.Title = strings.TrimLeft(strings.TrimLeft(s, "#"), " ")
-			break
-		}
+	link := strings.NewReplacer(
+		":year", fmt.Sprintf("%04d", p.Date.Year()),
+		":month", fmt.Sprintf("%02d", p.Date.Month()),
+		":day", fmt.Sprintf("%02d", p.Date.Day()),
+		":slug", p.Slug,
+		":title", slugify(p.Title),
+	).Replace(config.Permalink)
+
+	if strings.HasSuffix(link, "/") {
+		link += "index.html"
+	} else if path.Ext(link) == "" {
+		link = pagePath(link)
 	}
+	return strings.TrimPrefix(path.Clean("/"+link), "/")
+}
 
-	// convert markdown to html
-	content := strings.Join(lines, "\n")
-	output := blackfriday.MarkdownCommon([]byte(content))
-	post.Content = string(output)
+// absolute url of the post
+func (p Post) URL() string {
+	return pageURL(p.Path())
+}
 
-	return post, nil
+// post date in the site wide DateFormat
+func (p Post) FormattedDate() string {
+	return formatDate(config.DateFormat, p.Date)
 }
 
-func parseDate(name string) (time.Time, error) {
-	if r, err := regexp.Compile(`(\d{1,4})-(\d{1,2})-(\d{1,2})`); err == nil {
-		// find date string
-		ds := r.FindString(name)
-		// quick check
-		if len(ds) == 10 {
-			if d, err := time.Parse("2006-01-02", ds); err == nil {
-				return d, nil
-			} else {
-				return time.Now(), err
-			}
-		}
-	} else {
-		return time.Now(), err
+// content for listings, cut after IndexParagraphs blocks or IndexTruncate
+// characters of text, whichever comes first, and followed by a link to the
+// post when shortened
+func (p Post) IndexContent() string {
+	out, cut := truncateHTML(p.Content, config.IndexTruncate, config.IndexParagraphs)
+	if !cut {
+		return p.Content
 	}
-	return time.Now(), fmt.Errorf("Unable to parse date from string: %v", name)
+	return out + fmt.Sprintf("\n<p class=\"more\"><a href=\"%v\">Read more</a></p>", p.URL())
 }
 
-func trimPath(path string) string {
-	fn := filepath.Base(path)
-	ext := filepath.Ext(fn)
-	return strings.TrimRight(fn, ext)
+// last update in the site wide DateFormat
+func (p Post) FormattedModified() string {
+	return formatDate(config.DateFormat, p.Modified)
 }
 
-func renderTemplate(tmplPath string, tmplData interface{}) ([]byte, error) {
-	// read template
-	data, err := ioutil.ReadFile(tmplPath)
-	if err != nil {
-		return nil, err
+// friendly names usable in place of a go date layout
+var dateFormats = map[string]string{
+	"short":   "Jan 2, 2006",
+	"long":    "January 2, 2006",
+	"iso":     "2006-01-02",
+	"rfc3339": time.RFC3339,
+}
+
+// format t with a go layout or one of dateFormats, short by default. the
+// argument order allows {{ .Date | dateFormat "long" }} in templates.
+func formatDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	if layout == "" {
+		layout = "short"
+	}
+	if alias, ok := dateFormats[strings.ToLower(layout)]; ok {
+		layout = alias
+	}
+	return t.Format(layout)
+}
 
-	// parse template
-	tmpl, err := template.New(tmplPath).Parse(string(data))
-	if err != nil {
-		return nil, err
+// slash separated output path of the page name, like tags/go, relative to
+// OutputDir. with PrettyURLs every page is the index.html of its own directory.
+func pagePath(name string) string {
+	if config.PrettyURLs {
+		return name + "/index.html"
 	}
+	return name + ".html"
+}
 
-	buffer := new(bytes.Buffer)
-	if err := tmpl.Execute(buffer, tmplData); err != nil {
-		return nil, err
+// absolute url of the page at output path p, ending in a slash for directory
+// index files
+func pageURL(p string) string {
+	if path.Base(p) == "index.html" {
+		p = strings.TrimSuffix(p, "index.html")
 	}
+	return config.BaseURL + "/" + p
+}
 
-	return []byte(buffer.String()), nil
+// absolute url of the listing page for tag
+func tagURL(tag string) string {
+	return termURL("tags", tag)
 }
 
-func writeOutputFile(outFilePath string, html []byte) error {
-	// outfile := filepath.Join(config.OutputDir, strings.Join([]string{name, "html"}, "."))
-	err := ioutil.WriteFile(outFilePath, html, 0644)
-	if err != nil {
-		return err
+// resolved values for open graph and twitter card meta tags
+type MetaTags struct {
+	Title,
+	Description,
+	URL,
+	Type,
+	Image,
+	SiteName,
+	TwitterCard string
+}
+
+// social meta tags for the post, using DefaultImage when it has no image
+func (p Post) MetaTags() MetaTags {
+	meta := MetaTags{
+		Title:       p.Title,
+		Description: p.Excerpt,
+		URL:         p.URL(),
+		Type:        "article",
+		Image:       absURL(p.Image),
+		SiteName:    config.SiteTitle,
+		TwitterCard: "summary",
 	}
-	return nil
+	if meta.Image == "" {
+		meta.Image = absURL(config.DefaultImage)
+	}
+	if meta.Image != "" {
+		meta.TwitterCard = "summary_large_image"
+	}
+	return meta
 }
 
-func readConfig() error {
-	file, err := ioutil.ReadFile("config.json")
-	if err != nil {
-		return err
+// resolve a site relative link against BaseURL, absolute ones are kept
+func absURL(link string) string {
+	if link == "" {
+		return ""
 	}
-	if err := json.Unmarshal(file, &config); err != nil {
-		return err
+	if u, err := url.Parse(link); err == nil && u.IsAbs() {
+		return link
 	}
-	return nil
+	return config.BaseURL + "/" + strings.TrimLeft(link, "/")
 }
 
-func writeIndex(posts Posts) error {
-	// sort posts
-	sort.Sort(posts)
+type Posts []Post
 
-	// recent posts
-	out, err := renderTemplate(filepath.Join(config.TemplateDir, "recent.html"), posts)
-	if err != nil {
-		return err
+func (p Posts) Len() int           { return len(p) }
+func (p Posts) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p Posts) Less(i, j int) bool { return newerPost(&p[i], &p[j]) }
+
+// newest first, posts from the same moment by title and then source file so
+// builds are reproducible
+func newerPost(a, b *Post) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
 	}
+	return samePostDate(a, b)
+}
 
-	recent := struct {
-		Title,
-		Content string
-	}{
-		"my page",
-		string(out),
+// order of posts sharing a date
+func samePostDate(a, b *Post) bool {
+	if a.Title != b.Title {
+		return a.Title < b.Title
 	}
+	return a.Source < b.Source
+}
 
-	// tuck recent into main template
-	out, err = renderTemplate(filepath.Join(config.TemplateDir, "main.html"), recent)
-	if err != nil {
-		return err
+// orders usable as SortBy for the index and listings, feeds and post
+// navigation stay newest first
+var postOrders = map[string]func(a, b *Post) bool{
+	"date-desc": newerPost,
+	"date-asc": func(a, b *Post) bool {
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return samePostDate(a, b)
+	},
+	"title": func(a, b *Post) bool {
+		if x, y := strings.ToLower(a.Title), strings.ToLower(b.Title); x != y {
+			return x < y
+		}
+		return newerPost(a, b)
+	},
+}
+
+// listing order following SortBy, optionally with pinned posts first
+type listingOrder struct {
+	Posts
+	pinned bool
+}
+
+func (o listingOrder) Less(i, j int) bool {
+	if o.pinned && o.Posts[i].Pinned != o.Posts[j].Pinned {
+		return o.Posts[i].Pinned
 	}
+	less, ok := postOrders[config.SortBy]
+	if !ok {
+		less = postOrders["date-desc"]
+	}
+	return less(&o.Posts[i], &o.Posts[j])
+}
 
-	if err := writeOutputFile(filepath.Join(config.OutputDir, "index.html"), out); err != nil {
-		return err
+// front matter is an optional yaml block at the top of a source file,
+// delimited by --- lines
+type FrontMatter struct {
+	Title   string   `yaml:"title"`
+	Slug    string   `yaml:"slug"`
+	Date    string   `yaml:"date"`
+	LastMod string   `yaml:"lastmod"`
+	Draft   bool     `yaml:"draft"`
+	Pinned  bool     `yaml:"pinned"`
+	Tags    []string `yaml:"tags"`
+	Author  string   `yaml:"author"`
+	Email   string   `yaml:"email"`
+	Summary string   `yaml:"summary"`
+	Layout  string   `yaml:"layout"`
+	Output  string   `yaml:"output"`
+	Image   string   `yaml:"image"`
+	Series  string   `yaml:"series"`
+	Part    int      `yaml:"part"` // order within series
+	Lang    string   `yaml:"lang"`
+
+	// shared by the translations of a post
+	TranslationKey string `yaml:"translationKey"`
+
+	// every other key, for templates
+	Params map[string]interface{} `yaml:"-"`
+}
+
+// keys of the FrontMatter fields, left out of Params
+var reservedFrontMatter = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(FrontMatter{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("yaml"); key != "" && key != "-" {
+			keys[key] = true
+		}
 	}
+	return keys
+}()
 
-	return nil
+// strip a leading utf-8 byte order mark and turn crlf line endings into lf
+func normalizeSource(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+}
+
+// split leading front matter from data, returning the parsed block and the
+// remaining body. data without front matter yields a zero FrontMatter.
+func parseFrontMatter(data []byte) (FrontMatter, []byte, error) {
+	fm := FrontMatter{}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], " ") != "---" {
+		return fm, data, nil
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], " ") == "---" {
+			block := strings.Join(lines[1:i], "\n")
+			if err := yaml.Unmarshal([]byte(block), &fm); err != nil {
+				return fm, nil, fmt.Errorf("Unable to parse front matter: %v", err)
+			}
+			if err := yaml.Unmarshal([]byte(block), &fm.Params); err != nil {
+				return fm, nil, fmt.Errorf("Unable to parse front matter: %v", err)
+			}
+			for key := range fm.Params {
+				if reservedFrontMatter[key] {
+					delete(fm.Params, key)
+				}
+			}
+			body := strings.Join(lines[i+1:], "\n")
+			return fm, []byte(body), nil
+		}
+	}
+
+	return fm, nil, fmt.Errorf("Unable to parse front matter: missing closing ---")
 }
 
-func writePost(mdPath string) (*Post, error) {
-	// parse post
-	post, err := parseSourceFile(mdPath)
+// parse markdown file and convert to html
+func parseSourceFile(srcFilePath string) (*Post, error) {
+	renderer := rendererFor(srcFilePath)
+	if renderer == nil {
+		return nil, fmt.Errorf("%v: No renderer for %v files", srcFilePath, filepath.Ext(srcFilePath))
+	}
+	post := &Post{}
+
+	post.Source = srcFilePath
+	post.Name = trimPath(srcFilePath)
+
+	// keep subdirectory of the source file relative to SourceDir
+	if rel, err := filepath.Rel(config.SourceDir, filepath.Dir(srcFilePath)); err == nil && rel != "." {
+		post.Dir = filepath.ToSlash(rel)
+	}
+
+	// read file
+	data, err := ioutil.ReadFile(srcFilePath)
 	if err != nil {
 		return nil, err
 	}
+	data = normalizeSource(data)
 
-	// render template
-	tmplPath := filepath.Join(config.TemplateDir, "main.html")
-	out, err := renderTemplate(tmplPath, post)
+	// front matter
+	fm, data, err := parseFrontMatter(data)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%v: %v", srcFilePath, err)
 	}
 
-	// write post
-	outFilePath := filepath.Join(config.OutputDir, post.Name+".html")
-	if err := writeOutputFile(outFilePath, out); err != nil {
-		return nil, err
+	// date, front matter takes precedence over filename
+	if fm.Date != "" {
+		d, err := parseFrontMatterDate(fm.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", srcFilePath, err)
+		}
+		if err := checkDateMismatch(post.Name, d); err != nil {
+			if config.StrictDates {
+				return nil, fmt.Errorf("%v: %v", srcFilePath, err)
+			}
+			log.Warningf("%v: %v", srcFilePath, err)
+		}
+		post.Date = d
+	} else {
+		d, err := parseDate(post.Name)
+		if err != nil {
+			if err != errNoDate {
+				log.Warningf("%v: %v", srcFilePath, err)
+			}
+			// fall back to when the file was first committed, or last modified
+			if d, err = gitCreated(srcFilePath); err != nil {
+				log.Debugf("%v: No git date: %v", srcFilePath, err)
+				info, err := os.Stat(srcFilePath)
+				if err != nil {
+					return nil, err
+				}
+				d = info.ModTime().In(timezone)
+			}
+		}
+		post.Date = d
 	}
 
-	// returning post to be stored in Posts
-	return post, nil
-}
+	// last update, front matter taking precedence over the file's mtime
+	if fm.LastMod != "" {
+		d, err := parseFrontMatterDate(fm.LastMod)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", srcFilePath, err)
+		}
+		post.Modified = d
+	} else {
+		info, err := os.Stat(srcFilePath)
+		if err != nil {
+			return nil, err
+		}
+		post.Modified = info.ModTime().In(timezone)
+	}
+	if post.Modified.Before(post.Date) {
+		post.Modified = post.Date
+	}
 
-func writeFeed(posts Posts) error {
-	// sort posts
-	sort.Sort(posts)
+	// parse title from front matter or first headline
+	post.Title = fm.Title
+	post.Tags = fm.Tags
+	post.Terms = postTerms(fm)
+	post.Image = fm.Image
 
-	// rss
-	out, err := renderTemplate(filepath.Join(config.TemplateDir, "feed.html"), posts)
-	if err != nil {
-		return err
+	// author, and email only along with the author it belongs to
+	post.Author, post.AuthorEmail = fm.Author, fm.Email
+	if post.Author == "" {
+		post.Author, post.AuthorEmail = config.DefaultAuthor, config.DefaultAuthorEmail
+	}
+	post.Draft = fm.Draft
+	post.Pinned = fm.Pinned
+	post.Series, post.SeriesPart = fm.Series, fm.Part
+	post.TranslationKey = fm.TranslationKey
+	if post.Lang, post.Dir, err = postLang(fm.Lang, post.Dir); err != nil {
+		return nil, fmt.Errorf("%v: %v", srcFilePath, err)
+	}
+	post.Params = fm.Params
+	lines := strings.Split(string(data), "\n")
+	if post.Title == "" {
+		post.Title = renderer.title(lines)
 	}
 
-	if err := writeOutputFile(filepath.Join(config.OutputDir, "feed.html"), out); err != nil {
-		return err
+	// layout named in front matter has to exist in TemplateDir
+	if fm.Layout != "" {
+		if fm.Layout != filepath.Base(fm.Layout) {
+			return nil, fmt.Errorf("%v: Invalid layout %q", srcFilePath, fm.Layout)
+		}
+		if _, err := os.Stat(filepath.Join(config.TemplateDir, fm.Layout+".html")); err != nil {
+			return nil, fmt.Errorf("%v: Unable to find layout %q in %v", srcFilePath, fm.Layout, config.TemplateDir)
+		}
+		post.Layout = fm.Layout
 	}
 
-	return nil
-}
+	// output file name has to stay inside the post's directory
+	if fm.Output != "" {
+		output := path.Clean(filepath.ToSlash(fm.Output))
+		if path.IsAbs(output) || output == "." || output == ".." || strings.HasPrefix(output, "../") {
+			return nil, fmt.Errorf("%v: Invalid output %q", srcFilePath, fm.Output)
+		}
+		post.Output = output
+	}
 
-func listSrcFiles() ([]string, error) {
-	return filepath.Glob(config.SourceDir + "/*.md")
-}
+	// slug from front matter, title or filename, in that order
+	post.Slug = slugify(fm.Slug)
+	if post.Slug == "" {
+		post.Slug = slugify(post.Title)
+	}
+	if post.Slug == "" {
+		post.Slug = post.Name
+	}
 
-func prepare() error {
-	// add current date to source files if date not manually set
-	srcFiles, err := listSrcFiles()
-	if err != nil { 
-		return err
+	// convert to html
+	content := strings.Join(lines, "\n")
+	output, toc, err := renderer.render([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", srcFilePath, err)
 	}
+	if config.Emoji {
+		output = replaceEmoji(output)
+	}
+	if config.Sanitize {
+		output = sanitizeHTML(output)
+	}
+	post.Content = string(output)
+	post.TOC = toc
 
-	for _, srcFile := range srcFiles {
-		name := trimPath(srcFile)
-		date, err := parseDate(name)
-		// add current date if parsedate failed (meaning no date prefix in filename)
+	// excerpt from front matter, text before the more marker or first paragraph
+	if fm.Summary != "" {
+		post.Excerpt = fm.Summary
+	} else if i := strings.Index(content, moreMarker); i >= 0 {
+		intro, _, err := renderer.render([]byte(content[:i]))
 		if err != nil {
-			dateStr := date.Format("2006-01-02")
-			newname := filepath.Join(config.SourceDir, dateStr + "-" + name + filepath.Ext(srcFile))
-			if err := os.Rename(srcFile, newname); err == nil {
-				log.Debugf("Renamed %v to %v", srcFile, newname)
-			} else {
-				// we still want to return nil error since it's not fatal
-				log.Error(err)
+			return nil, fmt.Errorf("%v: %v", srcFilePath, err)
+		}
+		if config.Emoji {
+			intro = replaceEmoji(intro)
+		}
+		post.Excerpt = plainText(headingPattern.ReplaceAllString(string(intro), ""))
+	} else {
+		post.Excerpt = plainText(paragraphPattern.FindString(post.Content))
+	}
+
+	// counts of the plain text content
+	text := plainText(post.Content)
+	post.WordCount = len(strings.Fields(text))
+	post.CharCount = utf8.RuneCountInString(text)
+
+	// reading time, rounded up to whole minutes
+	wpm := config.WordsPerMinute
+	if wpm <= 0 {
+		wpm = 200
+	}
+	post.ReadingTime = (post.WordCount + wpm - 1) / wpm
+
+	return post, nil
+}
+
+// text of the first markdown headline in lines, ignoring fenced code blocks
+func findTitle(lines []string) string {
+	fence := ""
+	for _, line := range lines {
+		s := strings.TrimLeft(line, " ")
+
+		// inside a code block until the closing fence
+		if fence != "" {
+			if strings.HasPrefix(s, fence) {
+				fence = ""
 			}
+			continue
+		}
+		if strings.HasPrefix(s, "```") || strings.HasPrefix(s, "~~~") {
+			fence = s[:3]
+			continue
+		}
+
+		if strings.HasPrefix(s, "#") {
+			return strings.TrimLeft(strings.TrimLeft(s, "#"), " ")
 		}
 	}
+	return ""
+}
 
-	return nil
+// strip tags and entities from html, collapsing whitespace. inline tags go
+// without a trace so punctuation stays with the word before it.
+func plainText(s string) string {
+	s = inlineTagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(tagPattern.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
 }
 
-func main() {
-	// read config
-	if err := readConfig(); err != nil {
-		log.Error(err)
-		os.Exit(1)
+// parse a yyyy-mm-dd date from name. a name without one gives errNoDate,
+// failures always come with the zero time.
+func parseDate(name string) (time.Time, error) {
+	// find date string
+	ds := datePattern.FindString(name)
+	// quick check
+	if len(ds) != 10 {
+		return time.Time{}, errNoDate
 	}
 
-	// prepare
-	if err := prepare(); err != nil {
-		log.Error(err)
-		os.Exit(1)
+	d, err := time.ParseInLocation("2006-01-02", ds, timezone)
+	if err != nil {
+		return time.Time{}, err
 	}
+	return d, nil
+}
 
-	// collect source files
-	srcFiles, err := listSrcFiles()
+// error when name carries a date on another day than the front matter date d
+func checkDateMismatch(name string, d time.Time) error {
+	named, err := parseDate(name)
 	if err != nil {
-		log.Error(err)
-		os.Exit(1)
+		return nil
 	}
+	if d = d.In(timezone); named.Format("2006-01-02") != d.Format("2006-01-02") {
+		return fmt.Errorf("File name date %v differs from front matter date %v, using front matter",
+			named.Format("2006-01-02"), d.Format("2006-01-02"))
+	}
+	return nil
+}
 
-	// write posts
-	posts := make(Posts, len(srcFiles))
-	for i, srcFile := range srcFiles {
-		if post, err := writePost(srcFile); err == nil {
-			log.Info("Saved post: " + post.Name)
-			posts[i] = *post
-		} else { // error
-			log.Error(err)
+// layouts accepted for front matter dates. those without an offset are in
+// the configured Timezone.
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseFrontMatterDate(s string) (time.Time, error) {
+	for _, layout := range frontMatterDateLayouts {
+		if d, err := time.ParseInLocation(layout, s, timezone); err == nil {
+			return d, nil
 		}
 	}
+	return time.Time{}, fmt.Errorf("Unable to parse front matter date: %v", s)
+}
 
-	// write index
-	if err := writeIndex(posts); err == nil {
-		log.Info("Saved index")
-	} else { // error
-		log.Error(err)
+func trimPath(path string) string {
+	fn := filepath.Base(path)
+	ext := sourceExt(fn)
+	if ext == "" {
+		ext = filepath.Ext(fn)
 	}
+	return fn[:len(fn)-len(ext)]
+}
 
-	// write feed
-	if err := writeFeed(posts); err == nil {
-		log.Info("Saved feed")
+// the configured SourceExtensions entry name ends with, preferring the
+// longest, or an empty string for files that aren't sources
+func sourceExt(name string) string {
+	match := ""
+	for _, ext := range config.SourceExtensions {
+		if len(ext) > len(match) && len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			match = name[len(name)-len(ext):]
+		}
+	}
+	return match
+}
+
+// cut s down to at most n characters, ending in an ellipsis when shortened.
+// the argument order allows {{ .Title | truncate 20 }} in templates.
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if n == 0 {
+		return ""
+	}
+	return strings.TrimRightFunc(string(runes[:n-1]), unicode.IsSpace) + "…"
+}
+
+// convert a name into a lowercase, hyphen separated string safe for filenames
+func slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			hyphen = false
+		} else if !hyphen {
+			b.WriteRune('-')
+			hyphen = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// read and parse the template at tmplPath along with all partials
+func parseTemplate(tmplPath string) (*template.Template, error) {
+	// read template
+	data, err := ioutil.ReadFile(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// parse template
+	funcs := template.FuncMap{
+		"baseURL":    func() string { return config.BaseURL },
+		"siteTitle":  func() string { return config.SiteTitle },
+		"tagURL":     tagURL,
+		"termURL":    termURL,
+		"dateFormat": formatDate,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"truncate":   truncate,
+		"urlize":     slugify,
+	}
+	tmpl := template.New(tmplPath).Funcs(funcs)
+
+	// partials can be included from any template with {{ template "name" . }}
+	partials := filepath.Join(config.TemplateDir, "partials", "*.html")
+	if matches, _ := filepath.Glob(partials); len(matches) > 0 {
+		if _, err := tmpl.ParseGlob(partials); err != nil {
+			return nil, err
+		}
+	}
+
+	// templates defining a content block fill it in base.html, which is
+	// parsed first so their blocks replace its defaults
+	base := filepath.Join(config.TemplateDir, "base.html")
+	if tmplPath != base && contentBlockPattern.Match(data) {
+		baseData, err := ioutil.ReadFile(base)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to extend base.html in %v: %v", tmplPath, err)
+		}
+		if _, err := tmpl.New(base).Parse(string(baseData)); err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.Parse(string(data)); err != nil {
+			return nil, err
+		}
+		return tmpl.Lookup(base), nil
+	}
+
+	if _, err := tmpl.Parse(string(data)); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// definition of the block a template extending base.html fills
+var contentBlockPattern = regexp.MustCompile(`{{-?\s*define\s+"content"`)
+
+// parsed templates by path, along with the modification times they were parsed at
+var templates = struct {
+	sync.Mutex
+	cache map[string]cachedTemplate
+}{cache: make(map[string]cachedTemplate)}
+
+type cachedTemplate struct {
+	tmpl  *template.Template
+	stamp string
+}
+
+// modification times of tmplPath, base.html and the partials, changing
+// whenever any of them is edited, added or removed
+func templateStamp(tmplPath string) (string, error) {
+	partials, err := filepath.Glob(filepath.Join(config.TemplateDir, "partials", "*.html"))
+	if err != nil {
+		return "", err
+	}
+	files := append([]string{tmplPath}, partials...)
+	if base := filepath.Join(config.TemplateDir, "base.html"); base != tmplPath {
+		if _, err := os.Stat(base); err == nil {
+			files = append(files, base)
+		}
+	}
+
+	var stamp []string
+	for _, p := range files {
+		info, err := os.Stat(p)
+		if err != nil {
+			return "", err
+		}
+		stamp = append(stamp, p+"@"+strconv.FormatInt(info.ModTime().UnixNano(), 10))
+	}
+	return strings.Join(stamp, ","), nil
+}
+
+// parsed template for tmplPath, parsing it again only if it or a partial changed
+func loadTemplate(tmplPath string) (*template.Template, error) {
+	stamp, err := templateStamp(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+
+	templates.Lock()
+	defer templates.Unlock()
+
+	if cached, ok := templates.cache[tmplPath]; ok && cached.stamp == stamp {
+		return cached.tmpl, nil
+	}
+
+	tmpl, err := parseTemplate(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+	templates.cache[tmplPath] = cachedTemplate{tmpl, stamp}
+	return tmpl, nil
+}
+
+func renderTemplate(tmplPath string, tmplData interface{}) ([]byte, error) {
+	tmpl, err := loadTemplate(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if *audit {
+		recordTemplate(tmplPath, tmpl)
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := tmpl.Execute(buffer, tmplData); err != nil {
+		return nil, err
+	}
+
+	return []byte(buffer.String()), nil
+}
+
+// templates every build renders
+var requiredTemplates = []string{"main.html", "recent.html", "feed.html"}
+
+// parse the required templates and any other html file in TemplateDir once,
+// so broken ones stop the build before anything is written
+func validateTemplates() error {
+	paths := make(map[string]bool)
+	for _, name := range requiredTemplates {
+		paths[filepath.Join(config.TemplateDir, name)] = true
+	}
+	others, err := filepath.Glob(filepath.Join(config.TemplateDir, "*.html"))
+	if err != nil {
+		return err
+	}
+	for _, p := range others {
+		paths[p] = true
+	}
+
+	var failed []string
+	for p := range paths {
+		if _, err := parseTemplate(p); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("Invalid templates:\n%v", strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+// write a generated file to outFilePath, rewriting links and minifying
+// .html pages
+func writeOutputFile(outFilePath string, html []byte) error {
+	// outfile := filepath.Join(config.OutputDir, strings.Join([]string{name, "html"}, "."))
+	if filepath.Ext(outFilePath) == ".html" {
+		dir := ""
+		if rel, err := filepath.Rel(config.OutputDir, filepath.Dir(outFilePath)); err == nil && rel != "." {
+			dir = filepath.ToSlash(rel)
+		}
+		html = prefixPaths(fingerprintLinks(addImageSizes(html, dir)))
+	}
+	if config.Minify && filepath.Ext(outFilePath) == ".html" {
+		minified, err := minifyHTML(html)
+		if err != nil {
+			return fmt.Errorf("Unable to minify %v: %v", outFilePath, err)
+		}
+		html = minified
+	}
+	return writeRawOutputFile(outFilePath, html)
+}
+
+// write data to outFilePath as it is, along with its gzip copy
+func writeRawOutputFile(outFilePath string, html []byte) error {
+	// hidden files such as the build cache aren't served
+	if config.PrecompressGzip && gzipExts[filepath.Ext(outFilePath)] && !strings.HasPrefix(filepath.Base(outFilePath), ".") {
+		gz, err := gzipBytes(html)
+		if err != nil {
+			return fmt.Errorf("Unable to compress %v: %v", outFilePath, err)
+		}
+		if err := writeRawOutputFile(outFilePath+".gz", gz); err != nil {
+			return err
+		}
+	}
+	keepOutput(outFilePath)
+	if *dryRun {
+		planWrite(outFilePath, int64(len(html)))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(outFilePath), 0755); err != nil {
+		return err
+	}
+	err := ioutil.WriteFile(outFilePath, html, 0644)
+	if err != nil {
+		return err
+	}
+	recordWrite(len(html))
+	return nil
+}
+
+// totals of the last build, for the summary after it
+var stats struct {
+	sync.Mutex
+	elapsed time.Duration
+	posts   int
+	words   int
+	files   int
+	bytes   int64
+}
+
+// count a file written to OutputDir
+func recordWrite(size int) {
+	stats.Lock()
+	stats.files++
+	stats.bytes += int64(size)
+	stats.Unlock()
+}
+
+func statsSummary() string {
+	stats.Lock()
+	defer stats.Unlock()
+	return fmt.Sprintf("Built %d posts (%d words) in %v, wrote %d files (%d bytes)",
+		stats.posts, stats.words, stats.elapsed.Round(time.Millisecond), stats.files, stats.bytes)
+}
+
+// files and bytes a dry run would have written
+var planned struct {
+	sync.Mutex
+	files int
+	bytes int64
+}
+
+// log and count a write skipped by -dryrun
+func planWrite(path string, size int64) {
+	log.Infof("Would write %v (%d bytes)", path, size)
+
+	planned.Lock()
+	planned.files++
+	planned.bytes += size
+	planned.Unlock()
+}
+
+// read config from name, or from config.toml or config.json when name is
+// empty, with INSTIGATOR_<FIELD> environment variables overriding both
+func readConfig(name string) error {
+	// defaults, overridden by whatever the config file sets
+	config.SourceDir = "content"
+	config.TemplateDir = "templates"
+	config.OutputDir = "public"
+	config.StaticDir = "static"
+	config.DataFile = "data.json"
+	config.DataDir = "data"
+	config.SiteTitle = defaultSiteTitle
+	config.SortBy = "date-desc"
+	config.FeedFullContent = true
+	config.Taxonomies = map[string]string{"tags": "tags"}
+	config.SanitizePolicy = "ugc"
+	config.Host = "localhost"
+	config.Port = 8080
+	// copied, decoding a config file reuses the slice
+	config.MarkdownExtensions = append([]string(nil), defaultMarkdownExtensions...)
+	config.SourceExtensions = []string{".md"}
+
+	var file []byte
+	var err error
+	if name != "" {
+		// an explicitly requested config file has to exist
+		if file, err = ioutil.ReadFile(name); err != nil {
+			return err
+		}
+	} else {
+		// config.toml takes precedence over config.json
+		name = "config.toml"
+		file, err = ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			name = "config.json"
+			file, err = ioutil.ReadFile(name)
+		} else if _, jsonErr := os.Stat("config.json"); err == nil && jsonErr == nil {
+			log.Warning("Found both config.toml and config.json, using config.toml")
+		}
+		if os.IsNotExist(err) {
+			log.Info("No config file found, using defaults")
+			file, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(bytes.TrimSpace(file)) > 0 {
+		if filepath.Ext(name) == ".toml" {
+			err = toml.Unmarshal(file, &config)
+		} else {
+			err = json.Unmarshal(file, &config)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to parse %v: %v", name, err)
+		}
+	}
+
+	if err := applyEnv(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(config.SiteTitle) == "" {
+		config.SiteTitle = defaultSiteTitle
+	}
+
+	// iana name such as Europe/Oslo, utc when unset
+	if config.Timezone != "" {
+		loc, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return fmt.Errorf("Invalid Timezone %q: %v", config.Timezone, err)
+		}
+		timezone = loc
+	}
+
+	if _, _, err := markdownOptions(config.MarkdownExtensions); err != nil {
+		return err
+	}
+
+	// taxonomy names end up in paths
+	if config.Taxonomies == nil {
+		config.Taxonomies = make(map[string]string)
+	}
+	if _, ok := config.Taxonomies["tags"]; !ok {
+		config.Taxonomies["tags"] = "tags"
+	}
+	for name, key := range config.Taxonomies {
+		if name != slugify(name) || key == "" {
+			return fmt.Errorf("Invalid taxonomy %q: %q", name, key)
+		}
+		if _, ok := termField(key); reservedFrontMatter[key] && !ok {
+			return fmt.Errorf("Invalid taxonomy %q: front matter key %q doesn't hold terms", name, key)
+		}
+	}
+
+	if _, ok := postOrders[config.SortBy]; !ok {
+		return fmt.Errorf("Invalid SortBy %q, expected date-desc, date-asc or title", config.SortBy)
+	}
+
+	for _, lang := range config.Languages {
+		if strings.Trim(lang, ".") == "" || strings.ContainsAny(lang, "/\\ ") {
+			return fmt.Errorf("Invalid language %q in Languages", lang)
+		}
+	}
+
+	if _, ok := sanitizePolicies[config.SanitizePolicy]; !ok {
+		return fmt.Errorf("Invalid SanitizePolicy %q, expected ugc or strict", config.SanitizePolicy)
+	}
+
+	// extensions may be given with or without the leading dot
+	for i, ext := range config.SourceExtensions {
+		if ext == "" {
+			return errors.New("Empty entry in SourceExtensions")
+		}
+		if !strings.HasPrefix(ext, ".") {
+			config.SourceExtensions[i] = "." + ext
+		}
+	}
+	if len(config.SourceExtensions) == 0 {
+		config.SourceExtensions = []string{".md"}
+	}
+
+	for _, pattern := range config.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil || strings.Trim(pattern, "/") == "" {
+			return fmt.Errorf("Invalid Exclude pattern %q", pattern)
+		}
+	}
+
+	// base url is optional, but must be absolute when set
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil {
+			return fmt.Errorf("Invalid BaseURL %q: %v", config.BaseURL, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Invalid BaseURL %q: missing scheme or host", config.BaseURL)
+		}
+		config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	}
+
+	// kept as /prefix, without a trailing slash
+	if p := strings.Trim(config.PathPrefix, "/"); p != "" {
+		config.PathPrefix = "/" + p
+	} else {
+		config.PathPrefix = ""
+	}
+	return nil
+}
+
+// log levels from least to most verbose
+var logLevels = []string{"error", "warning", "info", "debug"}
+
+// the configured LogLevel, one level more verbose with -v. unknown levels
+// fall back to info and aren't known.
+func logLevel() (string, bool) {
+	level := 2
+	known := config.LogLevel == ""
+	for i, name := range logLevels {
+		if strings.EqualFold(config.LogLevel, name) {
+			level, known = i, true
+		}
+	}
+	if *verbose && level < len(logLevels)-1 {
+		level++
+	}
+	return logLevels[level], known
+}
+
+// set up logging at the level from logLevel
+func setupLogging() {
+	level, known := logLevel()
+
+	// stdout is for the page with -render
+	out := &syncWriter{w: os.Stdout}
+	if *renderFile != "" {
+		out.w = os.Stderr
+	}
+
+	switch level {
+	case "error":
+		log = llog.New(out, llog.ERROR)
+	case "warning":
+		log = llog.New(out, llog.WARNING)
+	case "info":
+		log = llog.New(out, llog.INFO)
+	case "debug":
+		log = llog.New(out, llog.DEBUG)
+	}
+
+	if !known {
+		log.Warningf("Unknown LogLevel %q, using %v", config.LogLevel, level)
+	}
+}
+
+// prefix of environment variables overriding config fields
+const envPrefix = "INSTIGATOR_"
+
+// set config fields from INSTIGATOR_<FIELD> environment variables, the
+// field name in upper case. lists and maps are given as json.
+func applyEnv() error {
+	v := reflect.ValueOf(&config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := envPrefix + strings.ToUpper(t.Field(i).Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		var err error
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			var n int
+			if n, err = strconv.Atoi(value); err == nil {
+				field.SetInt(int64(n))
+			}
+		case reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(value); err == nil {
+				field.SetBool(b)
+			}
+		default:
+			// decoded into a fresh value, replacing the default entirely
+			fresh := reflect.New(field.Type())
+			if err = json.Unmarshal([]byte(value), fresh.Interface()); err == nil {
+				field.Set(fresh.Elem())
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %v %q: %v", name, value, err)
+		}
+	}
+	return nil
+}
+
+// command line flags beat the config file and environment
+func applyFlags() {
+	if *sourceDir != "" {
+		config.SourceDir = *sourceDir
+	}
+	if *templateDir != "" {
+		config.TemplateDir = *templateDir
+	}
+	if *outputDir != "" {
+		config.OutputDir = *outputDir
+	}
+}
+
+// make the directories absolute, reporting every required one that's missing
+func (c *Config) resolve() error {
+	var missing []string
+	for _, dir := range []struct {
+		name     string
+		path     *string
+		required bool
+	}{
+		{"SourceDir", &c.SourceDir, true},
+		{"TemplateDir", &c.TemplateDir, true},
+		{"OutputDir", &c.OutputDir, false},
+		{"StaticDir", &c.StaticDir, false},
+		{"DataFile", &c.DataFile, false},
+		{"DataDir", &c.DataDir, false},
+	} {
+		abs, err := filepath.Abs(*dir.path)
+		if err != nil {
+			return fmt.Errorf("Unable to resolve %v %v: %v", dir.name, *dir.path, err)
+		}
+		*dir.path = abs
+
+		if !dir.required {
+			continue
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			missing = append(missing, fmt.Sprintf("%v %v", dir.name, abs))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing directories: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// one page of the paginated index, for index.html or recent.html
+type IndexData struct {
+	Title    string
+	Lang     string // empty on the index of every language
+	Posts    Posts  // the posts on this page
+	AllPosts Posts  // every post, pinned ones first
+	Number,
+	Total int
+	PrevURL,
+	NextURL string // newer and older page, empty at either end
+}
+
+// slash separated output path of index page n, counting from 1
+func indexPagePath(n int) string {
+	if n == 1 {
+		return "index.html"
+	}
+	return pagePath(fmt.Sprintf("page/%d", n))
+}
+
+// number of index pages for n posts
+func indexPageCount(n int) int {
+	if config.PerPage <= 0 || n == 0 {
+		return 1
+	}
+	return (n + config.PerPage - 1) / config.PerPage
+}
+
+// write the index as index.html, page/2.html, ... with PerPage posts each,
+// newest first. all posts go on index.html when PerPage is unset. an
+// index.html template renders the whole page, otherwise recent.html is
+// tucked into main.html.
+func writeIndex(posts Posts) error {
+	return writeIndexPages("", config.SiteTitle, posts)
+}
+
+// write the paginated index of posts below dir, which is a language or
+// empty for the top level
+func writeIndexPages(dir, title string, posts Posts) error {
+	// sort posts, pinned ones first
+	sort.Sort(listingOrder{posts, true})
+
+	perPage := config.PerPage
+	if perPage <= 0 || perPage > len(posts) {
+		perPage = len(posts)
+	}
+	total := indexPageCount(len(posts))
+
+	indexTmpl := filepath.Join(config.TemplateDir, "index.html")
+	if _, err := os.Stat(indexTmpl); err != nil {
+		indexTmpl = ""
+	}
+
+	for n := 1; n <= total; n++ {
+		page := IndexData{Title: title, Lang: dir, AllPosts: posts, Number: n, Total: total}
+		if start := (n - 1) * perPage; start < len(posts) {
+			end := start + perPage
+			if end > len(posts) {
+				end = len(posts)
+			}
+			page.Posts = posts[start:end]
+		}
+		if n > 1 {
+			page.PrevURL = pageURL(path.Join(dir, indexPagePath(n-1)))
+		}
+		if n < total {
+			page.NextURL = pageURL(path.Join(dir, indexPagePath(n+1)))
+		}
+
+		out, err := renderIndex(indexTmpl, page)
+		if err != nil {
+			return err
+		}
+
+		if err := writeOutputFile(filepath.Join(config.OutputDir, filepath.FromSlash(path.Join(dir, indexPagePath(n)))), out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// render one index page with tmplPath, or with recent.html tucked into
+// main.html when tmplPath is empty
+func renderIndex(tmplPath string, page IndexData) ([]byte, error) {
+	if tmplPath != "" {
+		return renderTemplate(tmplPath, page)
+	}
+
+	// recent posts
+	out, err := renderTemplate(filepath.Join(config.TemplateDir, "recent.html"), page)
+	if err != nil {
+		return nil, err
+	}
+
+	recent := Page{
+		page.Title,
+		string(out),
+	}
+
+	// tuck recent into main template
+	return renderTemplate(filepath.Join(config.TemplateDir, "main.html"), recent)
+}
+
+// write posts.html from the optional posts.html template, listing every post
+// without pagination
+func writePostIndex(posts Posts) error {
+	tmplPath := filepath.Join(config.TemplateDir, "posts.html")
+	if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	// sort posts
+	sort.Sort(listingOrder{posts, false})
+
+	out, err := renderTemplate(tmplPath, posts)
+	if err != nil {
+		return err
+	}
+
+	page := Page{
+		"All posts",
+		string(out),
+	}
+
+	// tuck post index into main template
+	out, err = renderTemplate(filepath.Join(config.TemplateDir, "main.html"), page)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, filepath.FromSlash(pagePath("posts"))), out)
+}
+
+// render post with its template, see postTemplate
+func renderPost(post *Post) ([]byte, error) {
+	return renderTemplate(postTemplate(post), post)
+}
+
+// template post renders with: its layout, else post.html when there is one,
+// else main.html
+func postTemplate(post *Post) string {
+	if post.Layout != "" {
+		return filepath.Join(config.TemplateDir, post.Layout+".html")
+	}
+	tmplPath := filepath.Join(config.TemplateDir, "post.html")
+	if _, err := os.Stat(tmplPath); err == nil {
+		return tmplPath
+	}
+	return filepath.Join(config.TemplateDir, "main.html")
+}
+
+func writePost(post *Post) error {
+	// render template
+	out, err := renderPost(post)
+	if err != nil {
+		return err
+	}
+
+	// write post
+	outFilePath := filepath.Join(config.OutputDir, filepath.FromSlash(post.Path()))
+	if err := writeOutputFile(outFilePath, out); err != nil {
+		return err
+	}
+
+	// write markdown source
+	if config.CopySource {
+		if err := writePostSource(post); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write the markdown of post without its front matter, blog/foo.html and
+// blog/foo/index.html get blog/foo.md
+func writePostSource(post *Post) error {
+	data, err := ioutil.ReadFile(post.Source)
+	if err != nil {
+		return err
+	}
+	_, body, err := parseFrontMatter(normalizeSource(data))
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, filepath.FromSlash(sourcePath(post.Path()))), body)
+}
+
+// output path of the markdown for a post written to p
+func sourcePath(p string) string {
+	if path.Base(p) == "index.html" {
+		return path.Dir(p) + ".md"
+	}
+	return strings.TrimSuffix(p, path.Ext(p)) + ".md"
+}
+
+// write 404.html from the optional 404.html template, listing a few recent posts
+func write404(posts Posts) error {
+	tmplPath := filepath.Join(config.TemplateDir, "404.html")
+	if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	// sort posts
+	sort.Sort(posts)
+	if len(posts) > 5 {
+		posts = posts[:5]
+	}
+
+	notFound := struct {
+		Title string
+		Posts Posts
+		Site  Site
+	}{
+		config.SiteTitle,
+		posts,
+		site,
+	}
+
+	out, err := renderTemplate(tmplPath, notFound)
+	if err != nil {
+		return err
+	}
+
+	page := Page{
+		"Page not found",
+		string(out),
+	}
+
+	// tuck into main template
+	out, err = renderTemplate(filepath.Join(config.TemplateDir, "main.html"), page)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, "404.html"), out)
+}
+
+// run fn for every index below n using a pool of Concurrency workers
+func parallel(n int, fn func(i int)) {
+	workers := config.Concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// parse all source files. posts keep the order of srcFiles, files failing to
+// parse are left out and reported in errs.
+func parsePosts(srcFiles []string) (Posts, []error) {
+	parsed := make([]*Post, len(srcFiles))
+	failed := make([]error, len(srcFiles))
+	parallel(len(srcFiles), func(i int) {
+		parsed[i], failed[i] = parseSourceFile(srcFiles[i])
+	})
+
+	var posts Posts
+	var errs []error
+	for i := range srcFiles {
+		if failed[i] != nil {
+			errs = append(errs, failed[i])
+		} else {
+			posts = append(posts, *parsed[i])
+		}
+	}
+	return posts, errs
+}
+
+// set Prev and Next on each post of the sorted, newest first posts to the
+// adjacent ones in its language. they point to copies so later sorting of
+// posts doesn't move them.
+func linkPosts(posts Posts) {
+	neighbours := make(Posts, len(posts))
+	copy(neighbours, posts)
+
+	langs := make(map[string][]int)
+	for i := range posts {
+		langs[posts[i].langDir()] = append(langs[posts[i].langDir()], i)
+	}
+
+	for _, in := range langs {
+		for n, i := range in {
+			posts[i].Prev, posts[i].Next = nil, nil
+			if n > 0 {
+				posts[i].Next = &neighbours[in[n-1]]
+			}
+			if n < len(in)-1 {
+				posts[i].Prev = &neighbours[in[n+1]]
+			}
+		}
+	}
+}
+
+// set the series position, total and neighbours of each post in a series.
+// parts are ordered by their part number, then by date and source.
+func linkSeries(posts Posts) {
+	series := make(map[string][]int)
+	for i := range posts {
+		posts[i].SeriesPosition, posts[i].SeriesTotal = 0, 0
+		posts[i].SeriesPrev, posts[i].SeriesNext = nil, nil
+		if posts[i].Series != "" {
+			key := slugify(posts[i].Series)
+			series[key] = append(series[key], i)
+		}
+	}
+
+	for _, parts := range series {
+		sort.SliceStable(parts, func(a, b int) bool {
+			pa, pb := posts[parts[a]], posts[parts[b]]
+			if pa.SeriesPart != pb.SeriesPart {
+				return pa.SeriesPart < pb.SeriesPart
+			}
+			if !pa.Date.Equal(pb.Date) {
+				return pa.Date.Before(pb.Date)
+			}
+			return pa.Source < pb.Source
+		})
+
+		// copies, as with Prev and Next
+		ordered := make(Posts, len(parts))
+		for n, i := range parts {
+			ordered[n] = posts[i]
+		}
+		for n, i := range parts {
+			posts[i].SeriesPosition, posts[i].SeriesTotal = n+1, len(parts)
+			if n > 0 {
+				posts[i].SeriesPrev = &ordered[n-1]
+			}
+			if n < len(parts)-1 {
+				posts[i].SeriesNext = &ordered[n+1]
+			}
+		}
+	}
+}
+
+// set RelatedPosts on each of the sorted, newest first posts to the
+// RelatedCount others sharing most tags with it, newer first on equal counts
+func relatePosts(posts Posts) {
+	limit := config.RelatedCount
+	if limit <= 0 {
+		limit = 3
+	}
+
+	others := make(Posts, len(posts))
+	copy(others, posts)
+
+	tags := make([]map[string]bool, len(posts))
+	for i, post := range posts {
+		tags[i] = make(map[string]bool)
+		for _, tag := range post.Tags {
+			tags[i][slugify(tag)] = true
+		}
+	}
+
+	for i := range posts {
+		type candidate struct{ index, shared int }
+		var candidates []candidate
+		for j := range others {
+			if j == i {
+				continue
+			}
+			shared := 0
+			for tag := range tags[j] {
+				if tags[i][tag] {
+					shared++
+				}
+			}
+			if shared > 0 {
+				candidates = append(candidates, candidate{j, shared})
+			}
+		}
+
+		// stable, so posts keep their newest first order on equal counts
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return candidates[a].shared > candidates[b].shared
+		})
+		if len(candidates) > limit {
+			candidates = candidates[:limit]
+		}
+
+		posts[i].RelatedPosts = nil
+		for _, c := range candidates {
+			posts[i].RelatedPosts = append(posts[i].RelatedPosts, others[c.index])
+		}
+	}
+}
+
+// make sure no two posts are written to the same output path
+func checkOutputPaths(posts Posts) error {
+	generated := generatedPaths(len(posts))
+	sources := make(map[string][]string)
+	var paths []string
+	for _, post := range posts {
+		p := post.Path()
+		if _, ok := sources[p]; !ok {
+			paths = append(paths, p)
+		}
+		sources[p] = append(sources[p], post.Source)
+	}
+
+	var clashes []string
+	for _, p := range paths {
+		by := sources[p]
+		if page := generatedPage(generated, p); page != "" {
+			by = append(by, page)
+		}
+		if len(by) > 1 {
+			clashes = append(clashes, fmt.Sprintf("%v (from %v)", p, strings.Join(by, ", ")))
+		}
+	}
+	if len(clashes) > 0 {
+		return fmt.Errorf("Duplicate output paths: %v", strings.Join(clashes, "; "))
+	}
+	return nil
+}
+
+// slash separated paths of the pages, feeds and other files the build
+// generates besides posts, mapped to what they are
+func generatedPaths(n int) map[string]string {
+	paths := map[string]string{
+		"rss.xml":         "the rss feed",
+		"atom.xml":        "the atom feed",
+		"feed.json":       "the json feed",
+		"feed.html":       "the feed",
+		"sitemap.xml":     "the sitemap",
+		"search.json":     "the search index",
+		"robots.txt":      "robots.txt",
+		assetManifestFile: "the asset manifest",
+		"highlight.css":   "the highlight stylesheet",
+		"404.html":        "the 404 page",
+	}
+	for name, what := range map[string]string{"archive": "the archive", "posts": "the post index"} {
+		paths[pagePath(name)] = what
+	}
+
+	dirs := []string{""}
+	for _, lang := range config.Languages {
+		dirs = append(dirs, lang)
+		paths[path.Join(lang, "rss.xml")] = "the " + lang + " feed"
+	}
+	for _, dir := range dirs {
+		for i := 1; i <= indexPageCount(n); i++ {
+			paths[path.Join(dir, indexPagePath(i))] = "the index"
+		}
+	}
+	return paths
+}
+
+// what generates p besides posts, empty when nothing does. taxonomy pages
+// own everything below their taxonomy's directory.
+func generatedPage(generated map[string]string, p string) string {
+	if what, ok := generated[p]; ok {
+		return what
+	}
+	for name := range config.Taxonomies {
+		if strings.HasPrefix(p, name+"/") {
+			return "the " + name + " pages"
+		}
+	}
+	return ""
+}
+
+// write posts concurrently, the error for posts[i] is at errs[i]
+func writePosts(posts Posts) []error {
+	errs := make([]error, len(posts))
+	parallel(len(posts), func(i int) {
+		errs[i] = writePost(&posts[i])
+	})
+	return errs
+}
+
+func writeFeed(posts Posts) error {
+	// newest posts
+	posts = feedPosts(posts)
+
+	// rss
+	out, err := renderTemplate(filepath.Join(config.TemplateDir, "feed.html"), posts)
+	if err != nil {
+		return err
+	}
+
+	// an rss document despite the name, so no html rewriting
+	if err := writeRawOutputFile(filepath.Join(config.OutputDir, "feed.html"), out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// report whether file, or a directory it's in, matches an Exclude pattern
+func excluded(file string) bool {
+	rel, err := filepath.Rel(config.SourceDir, file)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range config.Exclude {
+		pattern = strings.Trim(pattern, "/")
+		for p := rel; p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+			if !strings.Contains(pattern, "/") {
+				if ok, _ := path.Match(pattern, path.Base(p)); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// collect source files under SourceDir, including subdirectories, warning
+// once about each extension there is no renderer for
+func listSrcFiles() ([]string, error) {
+	var srcFiles []string
+	unknown := make(map[string]bool)
+	err := filepath.Walk(config.SourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if excluded(path) {
+			log.Debugf("Excluding %v", path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		if rendererFor(info.Name()) != nil {
+			srcFiles = append(srcFiles, path)
+		} else if ext := filepath.Ext(path); !unknown[ext] {
+			unknown[ext] = true
+			log.Warningf("Skipping %v files in %v, no renderer for them", ext, config.SourceDir)
+		}
+		return nil
+	})
+	return srcFiles, err
+}
+
+func prepare() error {
+	// add current date to source files if date not manually set
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, srcFile := range srcFiles {
+		name := trimPath(srcFile)
+		// add current date if there is no date prefix in filename
+		if _, err := parseDate(name); err == errNoDate {
+			dateStr := time.Now().In(timezone).Format("2006-01-02")
+			newname := filepath.Join(filepath.Dir(srcFile), dateStr+"-"+name+filepath.Ext(srcFile))
+			if *dryRun {
+				log.Infof("Would rename %v to %v", srcFile, newname)
+			} else if err := os.Rename(srcFile, newname); err == nil {
+				log.Debugf("Renamed %v to %v", srcFile, newname)
+			} else {
+				// we still want to return nil error since it's not fatal
+				log.Error(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// run a complete build, force re-rendering posts the build cache considers
+// unchanged. errors for single pages are logged and the build carries on,
+// posts failing to parse or write are left out and fail the build at the end.
+func build(force bool) error {
+	start := time.Now()
+	stats.Lock()
+	stats.posts, stats.words, stats.files, stats.bytes = 0, 0, 0, 0
+	stats.Unlock()
+	defer func() {
+		stats.Lock()
+		stats.elapsed = time.Since(start)
+		stats.Unlock()
+	}()
+
+	planned.Lock()
+	planned.files, planned.bytes = 0, 0
+	planned.Unlock()
+	outputs.Lock()
+	outputs.paths = make(map[string]bool)
+	outputs.Unlock()
+	if *audit {
+		resetAudit()
+	}
+
+	if err := validateTemplates(); err != nil {
+		return err
+	}
+
+	// site data for every template
+	if err := loadSite(); err != nil {
+		return err
+	}
+
+	// prepare, only when asked to since it renames source files
+	if config.AutoDatePrefix {
+		if err := prepare(); err != nil {
+			return err
+		}
+	}
+
+	// collect source files
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		return err
+	}
+
+	// parse posts
+	posts, errs := parsePosts(srcFiles)
+	for _, err := range errs {
+		log.Error(err)
+	}
+	failed := len(errs)
+
+	// leave drafts and posts scheduled for later out of the build
+	now := time.Now()
+	scheduled := 0
+	published := posts[:0]
+	for i := range posts {
+		switch {
+		case posts[i].Draft && !*drafts:
+			log.Info("Skipped draft: " + posts[i].Name)
+		case posts[i].Date.After(now) && !*future:
+			log.Debugf("Skipped post scheduled for %v: %v", posts[i].Date, posts[i].Name)
+			scheduled++
+		default:
+			published = append(published, posts[i])
+		}
+	}
+	posts = published
+	if scheduled > 0 {
+		log.Infof("Skipped %d scheduled posts", scheduled)
+	}
+
+	// bail out before writing anything if posts would overwrite each other or
+	// a generated page
+	if err := checkOutputPaths(posts); err != nil {
+		return err
+	}
+
+	// link chronologically adjacent and related posts
+	sort.Sort(posts)
+	linkPosts(posts)
+	linkSeries(posts)
+	linkTranslations(posts)
+	relatePosts(posts)
+
+	// hashed asset names end up in every page, so a change needs a full rebuild
+	changed, err := fingerprintAssets()
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Debug("Fingerprinted assets changed, rebuilding all posts")
+		force = true
+	}
+
+	// only render posts whose source changed since the last build
+	cache := make(buildCache)
+	if !force {
+		cache = loadBuildCache()
+	}
+	var stale Posts
+	for _, post := range posts {
+		if cache.fresh(&post) {
+			log.Debug("Unchanged post: " + post.Name)
+			keepOutput(filepath.Join(config.OutputDir, filepath.FromSlash(post.Path())))
+			if config.PrecompressGzip && gzipExts[path.Ext(post.Path())] {
+				keepOutput(filepath.Join(config.OutputDir, filepath.FromSlash(post.Path()+".gz")))
+			}
+			if config.CopySource {
+				keepOutput(filepath.Join(config.OutputDir, filepath.FromSlash(sourcePath(post.Path()))))
+			}
+		} else {
+			stale = append(stale, post)
+		}
+	}
+
+	// write posts
+	written := 0
+	unwritten := make(map[string]bool)
+	for i, err := range writePosts(stale) {
+		if err == nil {
+			written++
+			log.Info("Saved post: " + stale[i].Name)
+			if err := cache.record(&stale[i]); err != nil {
+				log.Error(err)
+			}
+		} else { // error
+			log.Error(err)
+			unwritten[stale[i].Source] = true
+		}
+	}
+	if err := cache.save(); err != nil {
+		log.Error(err)
+	}
+
+	// keep posts that failed to write out of listings
+	if len(unwritten) > 0 {
+		kept := posts[:0]
+		for _, post := range posts {
+			if !unwritten[post.Source] {
+				kept = append(kept, post)
+			}
+		}
+		posts = kept
+		failed += len(unwritten)
+	}
+
+	// pages and files other than posts that failed to write
+	pageErrs := 0
+
+	// copy static assets
+	if err := copyStatic(); err == nil {
+		log.Info("Copied static assets")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write asset manifest
+	if config.Fingerprint {
+		if err := writeAssetManifest(); err == nil {
+			log.Info("Saved asset manifest")
+		} else { // error
+			log.Error(err)
+			pageErrs++
+		}
+	}
+
+	// stylesheet for class based highlighting
+	if config.HighlightStyle != "" && config.HighlightClasses {
+		if err := writeHighlightCSS(); err == nil {
+			log.Info("Saved highlight css")
+		} else { // error
+			log.Error(err)
+			pageErrs++
+		}
+	}
+
+	// write index
+	if err := writeIndex(posts); err == nil {
+		log.Info("Saved index")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write post index
+	if err := writePostIndex(posts); err != nil {
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write feed
+	feeds := 0
+	if err := writeFeed(posts); err == nil {
+		feeds++
+		log.Info("Saved feed")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write rss
+	if err := writeRSS(posts); err == nil {
+		feeds++
+		log.Info("Saved rss")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write atom
+	if err := writeAtom(posts); err == nil {
+		feeds++
+		log.Info("Saved atom")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write json feed
+	if err := writeJSONFeed(posts); err == nil {
+		feeds++
+		log.Info("Saved json feed")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write sitemap
+	if err := writeSitemap(posts); err == nil {
+		log.Info("Saved sitemap")
 	} else { // error
 		log.Error(err)
+		pageErrs++
+	}
+
+	// write robots.txt
+	if err := writeRobots(); err == nil {
+		log.Info("Saved robots.txt")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write archive
+	if err := writeArchive(posts); err == nil {
+		log.Info("Saved archive")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write 404 page
+	if err := write404(posts); err != nil {
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write search index
+	if err := writeSearchIndex(posts); err == nil {
+		log.Info("Saved search index")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write taxonomy pages
+	if err := writeTaxonomyPages(posts); err == nil {
+		log.Info("Saved taxonomy pages")
+	} else { // error
+		log.Error(err)
+		pageErrs++
+	}
+
+	// write language indexes and feeds
+	if len(config.Languages) > 0 {
+		if err := writeLanguages(posts); err == nil {
+			feeds += len(config.Languages)
+			log.Info("Saved language indexes")
+		} else { // error
+			log.Error(err)
+			pageErrs++
+		}
+	}
+
+	// count posts and words
+	stats.Lock()
+	stats.posts = len(posts)
+	for _, post := range posts {
+		stats.words += post.WordCount
+	}
+	stats.Unlock()
+
+	log.Infof("Built %d posts, %d failed", len(posts), failed)
+	if *dryRun {
+		planned.Lock()
+		log.Infof("Dry run, would write %d posts, %d index pages and %d feeds; %d files and %d bytes in total",
+			written, indexPageCount(len(posts)), feeds, planned.files, planned.bytes)
+		planned.Unlock()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d posts failed to build", failed)
+	}
+	if pageErrs > 0 {
+		return fmt.Errorf("%d pages and files failed to build", pageErrs)
+	}
+
+	// fail on links to pages the build didn't produce
+	if config.StrictLinks || *checkLinks {
+		broken := findBrokenLinks(posts)
+		for _, link := range broken {
+			log.Error(link)
+		}
+		if len(broken) > 0 {
+			return fmt.Errorf("%d broken internal links", len(broken))
+		}
+	}
+
+	// remove outputs left from deleted sources, only after a clean build
+	if *clean {
+		if err := cleanStale(); err != nil {
+			return err
+		}
+	}
+
+	if *audit {
+		if err := reportUnused(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create OutputDir when missing and make sure files can be written to it
+func checkOutputDir() error {
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return fmt.Errorf("Unable to create OutputDir %v: %v", config.OutputDir, err)
+	}
+	f, err := ioutil.TempFile(config.OutputDir, ".instigator")
+	if err != nil {
+		return fmt.Errorf("OutputDir %v is not writable: %v", config.OutputDir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func main() {
+	flag.Parse()
+
+	// stdout is for the page with -render, also while reading the config
+	if *renderFile != "" {
+		log = llog.New(&syncWriter{w: os.Stderr}, llog.DEBUG)
+	}
+
+	// init runs on an empty directory, before there is a config to read
+	if flag.Arg(0) == "init" {
+		if err := initSite(flag.Arg(1)); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// read config
+	if err := readConfig(*configFile); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	applyFlags()
+	setupLogging()
+	if err := config.resolve(); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	// single page on stdout, for editors
+	if *renderFile != "" {
+		if err := renderOne(*renderFile, os.Stdout); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// subcommands instead of a build
+	if ran, err := runCommand(flag.Args()); ran {
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// fail early rather than on every single write
+	if !*dryRun {
+		if err := checkOutputDir(); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	}
+
+	// serve output, reloading pages after each rebuild
+	if *serveMode {
+		rl := newReloader()
+		if _, err := startServer(rl); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		if err := watch(rl.notify); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// keep rebuilding on changes
+	if *watchMode {
+		if err := watch(nil); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// unchanged posts skip rendering, hiding the templates they use
+	err := build(*force || *audit)
+	log.Info(statsSummary())
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	if *deployTo != "" {
+		if err := deploy(*deployTo); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
 	}
 	fmt.Println()
 }
@@ -0,0 +1,2356 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keidaa/llog"
+)
+
+// reset config and flags to their defaults with a quiet log, putting
+// everything back when t ends
+func testConfig(t testing.TB) {
+	t.Helper()
+
+	savedConfig, savedLog, savedTimezone, savedSite, savedManifest := config, log, timezone, site, assetManifest
+	bools := []*bool{drafts, future, force, watchMode, serveMode, verbose, dryRun, clean, checkLinks, serveDrafts, audit}
+	savedBools := make([]bool, len(bools))
+	for i, b := range bools {
+		savedBools[i], *b = *b, false
+	}
+	strs := []*string{configFile, sourceDir, templateDir, outputDir, deployTo, renderFile}
+	savedStrs := make([]string, len(strs))
+	for i, s := range strs {
+		savedStrs[i], *s = *s, ""
+	}
+	t.Cleanup(func() {
+		config, log, timezone, site, assetManifest = savedConfig, savedLog, savedTimezone, savedSite, savedManifest
+		for i, b := range bools {
+			*b = savedBools[i]
+		}
+		for i, s := range strs {
+			*s = savedStrs[i]
+		}
+	})
+
+	log = llog.New(ioutil.Discard, llog.ERROR)
+	config, site, assetManifest = Config{}, Site{}, nil
+	name := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, name, "{}")
+	if err := readConfig(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reset config like testConfig, then read it from a config file name with
+// content
+func loadConfig(t *testing.T, name, content string) error {
+	t.Helper()
+	testConfig(t)
+	config = Config{}
+	p := filepath.Join(t.TempDir(), name)
+	writeFile(t, p, content)
+	return readConfig(p)
+}
+
+// testConfig with the site in a temporary directory: sources in content,
+// the default templates in templates and output going to public
+func testSite(t testing.TB) string {
+	t.Helper()
+	testConfig(t)
+
+	dir := t.TempDir()
+	config.SourceDir = filepath.Join(dir, "content")
+	config.TemplateDir = filepath.Join(dir, "templates")
+	config.OutputDir = filepath.Join(dir, "public")
+	config.StaticDir = filepath.Join(dir, "static")
+	config.DataFile = filepath.Join(dir, "data.json")
+	config.DataDir = filepath.Join(dir, "data")
+	config.BaseURL = "http://example.com"
+	if err := os.MkdirAll(config.SourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.CopyFS(config.TemplateDir, templates); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// write a source file to SourceDir, returning its path
+func writeSource(t testing.TB, name, content string) string {
+	t.Helper()
+	p := filepath.Join(config.SourceDir, filepath.FromSlash(name))
+	writeFile(t, p, content)
+	return p
+}
+
+// build the site set up by testSite, rendering every post. errors the build
+// only logs fail the test too.
+func testBuild(t *testing.T) {
+	t.Helper()
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.ERROR)
+	defer func() { log = llog.New(ioutil.Discard, llog.ERROR) }()
+
+	if err := build(true); err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() > 0 {
+		t.Fatalf("build logged errors:\n%v", logged.String())
+	}
+}
+
+// contents of the output file at slash separated path p
+func readOutput(t *testing.T, p string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(config.OutputDir, filepath.FromSlash(p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// write content to name, creating its directory
+func writeFile(t testing.TB, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrimPath(t *testing.T) {
+	testConfig(t)
+
+	for _, tc := range []struct{ path, want string }{
+		{"posts/2014-01-02-example.md", "2014-01-02-example"},
+		{"damp.md", "damp"},
+		{"md.md", "md"},
+		{"index.mdm.md", "index.mdm"},
+		{"a.b.c.md", "a.b.c"},
+		{"some/dir/v1.2.notes.md", "v1.2.notes"},
+		{"noext", "noext"},
+		{"notes.txt", "notes"},
+	} {
+		if got := trimPath(tc.path); got != tc.want {
+			t.Errorf("trimPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestTrimPathSourceExtensions(t *testing.T) {
+	testConfig(t)
+	config.SourceExtensions = []string{".md", ".markdown"}
+
+	for _, tc := range []struct{ path, want string }{
+		{"post.markdown", "post"},
+		{"post.MD", "post"},
+		{"down.markdown.md", "down.markdown"},
+	} {
+		if got := trimPath(tc.path); got != tc.want {
+			t.Errorf("trimPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	fm, body, err := parseFrontMatter([]byte("---\ntitle: Hello\ntags: [a, b]\ndraft: true\nmood: sunny\n---\nbody text\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.Title != "Hello" || len(fm.Tags) != 2 || !fm.Draft {
+		t.Errorf("front matter = %+v", fm)
+	}
+	if fm.Params["mood"] != "sunny" {
+		t.Errorf("Params = %v, want mood: sunny", fm.Params)
+	}
+	if _, ok := fm.Params["title"]; ok {
+		t.Errorf("Params = %v, reserved keys should be left out", fm.Params)
+	}
+	if string(body) != "body text\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestParseFrontMatterWithout(t *testing.T) {
+	data := []byte("# Title\n\ntext\n")
+	fm, body, err := parseFrontMatter(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.Title != "" || string(body) != string(data) {
+		t.Errorf("got %+v and %q, want empty front matter and the whole file", fm, body)
+	}
+}
+
+func TestParseFrontMatterMalformed(t *testing.T) {
+	for name, data := range map[string]string{
+		"bad yaml": "---\ntitle: [unclosed\n---\nbody\n",
+		"bad type": "---\ntags: {a: b}\n---\nbody\n",
+		"unclosed": "---\ntitle: Hello\nbody\n",
+	} {
+		_, _, err := parseFrontMatter([]byte(data))
+		if err == nil {
+			t.Errorf("%v: no error", name)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "Unable to parse front matter") {
+			t.Errorf("%v: error %q isn't descriptive", name, err)
+		}
+	}
+}
+
+func TestParseSourceFileFrontMatter(t *testing.T) {
+	testSite(t)
+	p := writeSource(t, "2020-01-02-hello.md", "---\ntitle: From Front Matter\nauthor: Ann\n---\n# Heading\n\nbody\n")
+
+	post, err := parseSourceFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "From Front Matter" || post.Author != "Ann" {
+		t.Errorf("got title %q and author %q", post.Title, post.Author)
+	}
+	if !strings.Contains(post.Content, "<p>body</p>") || strings.Contains(post.Content, "author:") {
+		t.Errorf("content = %q", post.Content)
+	}
+
+	// without front matter the first heading is the title
+	p = writeSource(t, "2020-01-03-plain.md", "# Plain Title\n\nbody\n")
+	if post, err = parseSourceFile(p); err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Plain Title" {
+		t.Errorf("title = %q, want Plain Title", post.Title)
+	}
+
+	p = writeSource(t, "2020-01-04-broken.md", "---\ntitle: [oops\n---\nbody\n")
+	if _, err := parseSourceFile(p); err == nil || !strings.Contains(err.Error(), p) {
+		t.Errorf("error = %v, want one naming %v", err, p)
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-published.md", "# Published\n\nbody\n")
+	writeSource(t, "2020-01-02-unfinished.md", "---\ntitle: Unfinished\ndraft: true\n---\nbody\n")
+
+	testBuild(t)
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "unfinished.html")); !os.IsNotExist(err) {
+		t.Errorf("draft written without -drafts: %v", err)
+	}
+	for _, p := range []string{"index.html", "feed.html", "rss.xml"} {
+		if strings.Contains(readOutput(t, p), "Unfinished") {
+			t.Errorf("draft listed in %v without -drafts", p)
+		}
+	}
+
+	*drafts = true
+	testBuild(t)
+	readOutput(t, "unfinished.html")
+	for _, p := range []string{"index.html", "feed.html", "rss.xml"} {
+		if page := readOutput(t, p); !strings.Contains(page, "Unfinished") || !strings.Contains(page, "Published") {
+			t.Errorf("%v doesn't list both posts with -drafts", p)
+		}
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	for _, tc := range []struct{ base, want string }{
+		{"http://example.com", "http://example.com"},
+		{"http://example.com/", "http://example.com"},
+		{"https://example.com/blog//", "https://example.com/blog"},
+		{"", ""},
+	} {
+		if err := loadConfig(t, "config.json", `{"BaseURL": "`+tc.base+`"}`); err != nil {
+			t.Errorf("BaseURL %q: %v", tc.base, err)
+			continue
+		}
+		if config.BaseURL != tc.want {
+			t.Errorf("BaseURL %q normalized to %q, want %q", tc.base, config.BaseURL, tc.want)
+		}
+	}
+
+	config.BaseURL = "https://example.com/blog"
+	post := Post{Slug: "hello", Dir: "notes"}
+	if got, want := post.URL(), "https://example.com/blog/notes/hello.html"; got != want {
+		t.Errorf("URL() = %q, want %q", got, want)
+	}
+}
+
+func TestBaseURLInvalid(t *testing.T) {
+	for _, base := range []string{"example.com", "/blog", "//example.com", "http://", "http://exa mple.com"} {
+		err := loadConfig(t, "config.json", `{"BaseURL": "`+base+`"}`)
+		if err == nil || !strings.Contains(err.Error(), "Invalid BaseURL") {
+			t.Errorf("BaseURL %q: error = %v, want Invalid BaseURL", base, err)
+		}
+	}
+}
+
+func TestNestedSources(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-top.md", "# Top\n\nbody\n")
+	writeSource(t, "blog/2020-01-02-foo.md", "# Foo\n\nbody\n")
+	writeSource(t, "blog/deep/2020-01-03-bar.md", "# Bar\n\nbody\n")
+
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srcFiles) != 3 {
+		t.Errorf("found %v, want all 3 sources", srcFiles)
+	}
+
+	testBuild(t)
+	for p, title := range map[string]string{
+		"top.html":           "Top",
+		"blog/foo.html":      "Foo",
+		"blog/deep/bar.html": "Bar",
+	} {
+		if !strings.Contains(readOutput(t, p), title) {
+			t.Errorf("%v doesn't hold post %v", p, title)
+		}
+	}
+}
+
+func TestConcurrentBuild(t *testing.T) {
+	testSite(t)
+	config.Concurrency = 8
+	for i := 0; i < 50; i++ {
+		writeSource(t, fmt.Sprintf("2020-01-%02d-post-%d.md", i%28+1, i), fmt.Sprintf("# Post %d\n\nbody %d\n", i, i))
+	}
+
+	testBuild(t)
+	for i := 0; i < 50; i++ {
+		if page := readOutput(t, fmt.Sprintf("post-%d.html", i)); !strings.Contains(page, fmt.Sprintf("body %d", i)) {
+			t.Errorf("post-%d.html doesn't hold its post", i)
+		}
+	}
+
+	// generated files come out the same on every build
+	index, rss := readOutput(t, "index.html"), readOutput(t, "rss.xml")
+	testBuild(t)
+	if readOutput(t, "index.html") != index || readOutput(t, "rss.xml") != rss {
+		t.Error("index and feed differ between builds")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	testConfig(t)
+	config.Concurrency = 3
+
+	var mu sync.Mutex
+	seen := make(map[int]int)
+	parallel(50, func(i int) {
+		mu.Lock()
+		seen[i]++
+		mu.Unlock()
+	})
+	for i := 0; i < 50; i++ {
+		if seen[i] != 1 {
+			t.Errorf("job %d ran %d times", i, seen[i])
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	for title, want := range map[string]string{
+		"Hello World":               "hello-world",
+		"Hello, World! What's up?":  "hello-world-what-s-up",
+		"--Leading and trailing--":  "leading-and-trailing",
+		"C++ & Go: a comparison...": "c-go-a-comparison",
+		"Café Ünïcode":              "café-ünïcode",
+		"東京 2020":                   "東京-2020",
+		"Привет, мир":               "привет-мир",
+		"!!!":                       "",
+	} {
+		if got := slugify(title); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestPostSlug(t *testing.T) {
+	testSite(t)
+	for _, tc := range []struct{ name, content, want string }{
+		{"2020-01-01-a.md", "---\ntitle: Some Title\nslug: Custom Slug!\n---\nbody\n", "custom-slug"},
+		{"2020-01-02-b.md", "---\ntitle: Why? Because.\n---\nbody\n", "why-because"},
+		{"2020-01-03-c.md", "# Ünïcode Title\n\nbody\n", "ünïcode-title"},
+		{"2020-01-04-no-title.md", "body\n", "2020-01-04-no-title"},
+	} {
+		post, err := parseSourceFile(writeSource(t, tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Slug != tc.want {
+			t.Errorf("slug of %v = %q, want %q", tc.name, post.Slug, tc.want)
+		}
+		if want := "http://example.com/" + tc.want + ".html"; post.URL() != want {
+			t.Errorf("URL of %v = %q, want %q", tc.name, post.URL(), want)
+		}
+	}
+}
+
+func TestDuplicateOutputPaths(t *testing.T) {
+	testSite(t)
+	first := writeSource(t, "2020-01-01-first.md", "---\ntitle: Same Title\n---\nbody\n")
+	second := writeSource(t, "2020-01-02-second.md", "---\nslug: same-title\n---\nbody\n")
+
+	err := build(true)
+	if err == nil {
+		t.Fatal("build with clashing slugs succeeded")
+	}
+	for _, want := range []string{"Duplicate output paths", "same-title.html", first, second} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %v", err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "same-title.html")); !os.IsNotExist(err) {
+		t.Errorf("clashing post written: %v", err)
+	}
+}
+
+func TestGeneratedOutputPaths(t *testing.T) {
+	testSite(t)
+	for _, tc := range []struct{ content, page string }{
+		{"---\ntitle: Archive\n---\nbody\n", "the archive"},
+		{"---\nslug: index\n---\nbody\n", "the index"},
+		{"---\noutput: rss.xml\n---\nbody\n", "the rss feed"},
+		{"---\nslug: go\n---\nbody\n", ""},
+	} {
+		post, err := parseSourceFile(writeSource(t, "2020-01-01-post.md", tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkOutputPaths(Posts{*post})
+		if tc.page == "" {
+			if err != nil {
+				t.Errorf("%v: %v", post.Path(), err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), post.Source) || !strings.Contains(err.Error(), tc.page) {
+			t.Errorf("%v: error = %v, want a clash with %v", post.Path(), err, tc.page)
+		}
+	}
+
+	// taxonomy pages own their directory
+	post := Post{Source: "a.md", Dir: "tags", Slug: "go"}
+	if err := checkOutputPaths(Posts{post}); err == nil || !strings.Contains(err.Error(), "the tags pages") {
+		t.Errorf("error = %v, want a clash with the tags pages", err)
+	}
+}
+
+func TestConfigMissing(t *testing.T) {
+	testConfig(t)
+	t.Chdir(t.TempDir())
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.INFO)
+
+	config = Config{}
+	if err := readConfig(""); err != nil {
+		t.Fatal(err)
+	}
+	if config.SourceDir != "content" || config.TemplateDir != "templates" || config.OutputDir != "public" {
+		t.Errorf("dirs = %v, %v, %v, want the defaults", config.SourceDir, config.TemplateDir, config.OutputDir)
+	}
+	if !strings.Contains(logged.String(), "using defaults") {
+		t.Errorf("log = %q, want a note about the defaults", logged.String())
+	}
+
+	// a config file asked for by name has to exist
+	if err := readConfig("missing.json"); err == nil {
+		t.Error("no error for a missing -config file")
+	}
+}
+
+func TestConfigEmpty(t *testing.T) {
+	for _, content := range []string{"", "  \n"} {
+		if err := loadConfig(t, "config.json", content); err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		if config.SourceDir != "content" || config.TemplateDir != "templates" || config.OutputDir != "public" {
+			t.Errorf("%q: dirs = %v, %v, %v, want the defaults", content, config.SourceDir, config.TemplateDir, config.OutputDir)
+		}
+	}
+}
+
+func TestConfigMalformed(t *testing.T) {
+	for _, content := range []string{"{", `{"SourceDir": 3}`, "not json"} {
+		err := loadConfig(t, "config.json", content)
+		if err == nil || !strings.Contains(err.Error(), "Unable to parse") || !strings.Contains(err.Error(), "config.json") {
+			t.Errorf("%q: error = %v, want one naming config.json", content, err)
+		}
+	}
+}
+
+func TestConfigTOML(t *testing.T) {
+	jsonConfig := `{
+	"SourceDir": "posts",
+	"OutputDir": "site",
+	"SiteTitle": "TOML & JSON",
+	"BaseURL": "https://example.com/",
+	"PerPage": 5,
+	"Minify": true,
+	"Exclude": ["drafts", "*.wip.md"],
+	"Taxonomies": {"categories": "category"}
+}`
+	tomlConfig := `# comments are the point
+SourceDir = "posts"
+OutputDir = "site"
+SiteTitle = "TOML & JSON"
+BaseURL = "https://example.com/"
+PerPage = 5
+Minify = true
+Exclude = ["drafts", "*.wip.md"]
+
+[Taxonomies]
+categories = "category"
+`
+	if err := loadConfig(t, "config.json", jsonConfig); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON := config
+	if err := loadConfig(t, "config.toml", tomlConfig); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, fromJSON) {
+		t.Errorf("toml config\n%+v\ndiffers from json config\n%+v", config, fromJSON)
+	}
+	if config.SourceDir != "posts" || config.PerPage != 5 || config.Taxonomies["categories"] != "category" {
+		t.Errorf("config = %+v", config)
+	}
+
+	if err := loadConfig(t, "config.toml", "PerPage = "); err == nil || !strings.Contains(err.Error(), "config.toml") {
+		t.Errorf("error = %v, want one naming config.toml", err)
+	}
+}
+
+func TestConfigTOMLPreferred(t *testing.T) {
+	testConfig(t)
+	t.Chdir(t.TempDir())
+	writeFile(t, "config.toml", `SiteTitle = "from toml"`)
+	writeFile(t, "config.json", `{"SiteTitle": "from json"}`)
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.WARNING)
+
+	config = Config{}
+	if err := readConfig(""); err != nil {
+		t.Fatal(err)
+	}
+	if config.SiteTitle != "from toml" {
+		t.Errorf("SiteTitle = %q, want the one from config.toml", config.SiteTitle)
+	}
+	if !strings.Contains(logged.String(), "using config.toml") {
+		t.Errorf("log = %q, want a warning about both files", logged.String())
+	}
+}
+
+func TestFlagPrecedence(t *testing.T) {
+	testConfig(t)
+
+	// default
+	if err := loadConfig(t, "config.json", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	applyFlags()
+	if config.OutputDir != "public" || config.SourceDir != "content" {
+		t.Errorf("dirs = %v, %v, want the defaults", config.OutputDir, config.SourceDir)
+	}
+
+	// config file beats default
+	if err := loadConfig(t, "config.json", `{"OutputDir": "file-out", "SourceDir": "file-src", "TemplateDir": "file-tmpl"}`); err != nil {
+		t.Fatal(err)
+	}
+	applyFlags()
+	if config.OutputDir != "file-out" || config.SourceDir != "file-src" || config.TemplateDir != "file-tmpl" {
+		t.Errorf("dirs = %v, %v, %v, want the config file's", config.OutputDir, config.SourceDir, config.TemplateDir)
+	}
+
+	// flags beat the config file, leaving what they don't set alone
+	*outputDir, *sourceDir = "flag-out", "flag-src"
+	applyFlags()
+	if config.OutputDir != "flag-out" || config.SourceDir != "flag-src" || config.TemplateDir != "file-tmpl" {
+		t.Errorf("dirs = %v, %v, %v, want the flags' and then the config file's", config.OutputDir, config.SourceDir, config.TemplateDir)
+	}
+	*templateDir = "flag-tmpl"
+	applyFlags()
+	if config.TemplateDir != "flag-tmpl" {
+		t.Errorf("TemplateDir = %v, want the flag's", config.TemplateDir)
+	}
+}
+
+func TestConfigFlag(t *testing.T) {
+	testConfig(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "config.json", `{"SiteTitle": "default file"}`)
+	writeFile(t, filepath.Join("ci", "site.json"), `{"SiteTitle": "from -config"}`)
+
+	*configFile = filepath.Join("ci", "site.json")
+	config = Config{}
+	if err := readConfig(*configFile); err != nil {
+		t.Fatal(err)
+	}
+	if config.SiteTitle != "from -config" {
+		t.Errorf("SiteTitle = %q, want the one from the -config file", config.SiteTitle)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	testSite(t)
+	for _, tc := range []struct{ name, content, want string }{
+		{"2020-01-01-summary.md", "---\nsummary: Given in front matter.\n---\n# Title\n\nFirst paragraph.\n", "Given in front matter."},
+		{"2020-01-02-more.md", "# Title\n\nIntro with *emphasis*.\n\nSecond part.\n\n<!--more-->\n\nRest of it.\n", "Intro with emphasis. Second part."},
+		{"2020-01-03-auto.md", "# Title\n\nFirst [paragraph](http://example.org) & more.\n\nSecond paragraph.\n", "First paragraph & more."},
+	} {
+		post, err := parseSourceFile(writeSource(t, tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(post.Excerpt) != tc.want {
+			t.Errorf("excerpt of %v = %q, want %q", tc.name, post.Excerpt, tc.want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	for in, want := range map[string]string{
+		"<p>Some <em>emphasis</em>, <a href=\"/x\">a link</a>.</p>": "Some emphasis, a link.",
+		"<p>one</p><p>two</p>":                      "one two",
+		"<ul>\n<li>a</li>\n<li>b&amp;c</li>\n</ul>": "a b&c",
+		"line<br>break":                             "line break",
+	} {
+		if got := plainText(in); got != want {
+			t.Errorf("plainText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	testSite(t)
+	words := func(n int) string { return strings.TrimSpace(strings.Repeat("word ", n)) }
+	for _, tc := range []struct {
+		name, content       string
+		wpm, words, minutes int
+	}{
+		{"2020-01-01-empty.md", "", 0, 0, 0},
+		{"2020-01-02-short.md", words(10), 0, 10, 1},
+		{"2020-01-03-exact.md", words(400), 0, 400, 2},
+		{"2020-01-04-long.md", words(1001), 0, 1001, 6},
+		{"2020-01-05-slow.md", words(1001), 100, 1001, 11},
+		// markup doesn't count as words
+		{"2020-01-06-markup.md", "Some **bold** and [a link](http://example.org/a/long/url) `code`\n", 0, 6, 1},
+	} {
+		config.WordsPerMinute = tc.wpm
+		post, err := parseSourceFile(writeSource(t, tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.WordCount != tc.words || post.ReadingTime != tc.minutes {
+			t.Errorf("%v: %d words and %d minutes, want %d and %d", tc.name, post.WordCount, post.ReadingTime, tc.words, tc.minutes)
+		}
+	}
+}
+
+func TestLinkPosts(t *testing.T) {
+	testConfig(t)
+	posts := testPosts(3)
+	sort.Sort(posts)
+	linkPosts(posts)
+
+	// newest first
+	newest, middle, oldest := posts[0], posts[1], posts[2]
+	if newest.Next != nil || newest.Prev == nil || newest.Prev.Title != "Post 1" {
+		t.Errorf("newest post links prev %v and next %v", newest.Prev, newest.Next)
+	}
+	if middle.Prev == nil || middle.Prev.Title != "Post 0" || middle.Next == nil || middle.Next.Title != "Post 2" {
+		t.Errorf("middle post links prev %v and next %v", middle.Prev, middle.Next)
+	}
+	if oldest.Prev != nil || oldest.Next == nil || oldest.Next.Title != "Post 1" {
+		t.Errorf("oldest post links prev %v and next %v", oldest.Prev, oldest.Next)
+	}
+
+	// links survive sorting posts again
+	sort.Sort(sort.Reverse(posts))
+	if posts[2].Prev.Title != "Post 1" {
+		t.Errorf("prev of newest post moved to %v", posts[2].Prev.Title)
+	}
+}
+
+func TestPrevNextPages(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `prev={{ with .Prev }}{{ .URL }}{{ end }} next={{ with .Next }}{{ .URL }}{{ end }}`)
+	writeSource(t, "2020-01-01-first.md", "# First\n")
+	writeSource(t, "2020-01-02-second.md", "# Second\n")
+	writeSource(t, "2020-01-03-third.md", "# Third\n")
+	testBuild(t)
+
+	for p, want := range map[string]string{
+		"first.html":  "prev= next=http://example.com/second.html",
+		"second.html": "prev=http://example.com/first.html next=http://example.com/third.html",
+		"third.html":  "prev=http://example.com/second.html next=",
+	} {
+		if got := readOutput(t, p); got != want {
+			t.Errorf("%v = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestPartials(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "partials", "banner.html"), `{{ define "banner" }}<div class="banner">{{ siteTitle }}: {{ .Title }}</div>{{ end }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ template "banner" . }}{{ .Content }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "recent.html"), `{{ template "banner" . }}{{ range .Posts }}{{ .Title }}{{ end }}`)
+	writeSource(t, "2020-01-01-post.md", "# Post\n\nbody\n")
+	testBuild(t)
+
+	if got := readOutput(t, "post.html"); !strings.HasPrefix(got, `<div class="banner">My Site: Post</div>`) {
+		t.Errorf("post page = %q, want the banner partial", got)
+	}
+	if got := readOutput(t, "index.html"); !strings.Contains(got, `<div class="banner">My Site: `) {
+		t.Errorf("index = %q, want the banner partial", got)
+	}
+
+	// a broken partial fails every template including it
+	writeFile(t, filepath.Join(config.TemplateDir, "partials", "banner.html"), `{{ define "banner" }}{{ .Title }`)
+	if err := validateTemplates(); err == nil || !strings.Contains(err.Error(), "banner.html") {
+		t.Errorf("error = %v, want one naming the broken partial", err)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	if err := loadConfig(t, "config.json", `{"Timezone": "Asia/Tokyo"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := parseDate("2020-03-04-post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Format(time.RFC3339); got != "2020-03-04T00:00:00+09:00" {
+		t.Errorf("date from file name = %v, want midnight in Tokyo", got)
+	}
+	if got := d.Format(time.RFC1123Z); got != "Wed, 04 Mar 2020 00:00:00 +0900" {
+		t.Errorf("feed date = %v, want the Tokyo offset", got)
+	}
+
+	for s, want := range map[string]string{
+		"2023-01-02T15:04:05Z":      "2023-01-02T15:04:05Z",
+		"2023-01-02T15:04:05-05:00": "2023-01-02T15:04:05-05:00",
+		"2023-01-02T15:04:05":       "2023-01-02T15:04:05+09:00",
+		"2023-01-02 15:04:05":       "2023-01-02T15:04:05+09:00",
+		"2023-01-02":                "2023-01-02T00:00:00+09:00",
+	} {
+		d, err := parseFrontMatterDate(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+		} else if got := d.Format(time.RFC3339); got != want {
+			t.Errorf("%q parsed as %v, want %v", s, got, want)
+		}
+	}
+	if _, err := parseFrontMatterDate("January 2nd"); err == nil {
+		t.Error("no error for an unparseable front matter date")
+	}
+}
+
+func TestTimezoneInvalid(t *testing.T) {
+	err := loadConfig(t, "config.json", `{"Timezone": "Mars/Olympus"}`)
+	if err == nil || !strings.Contains(err.Error(), "Invalid Timezone") {
+		t.Errorf("error = %v, want Invalid Timezone", err)
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	testConfig(t)
+	for _, name := range []string{"undated-post", "2020-1-2-short", "notes"} {
+		d, err := parseDate(name)
+		if err != errNoDate {
+			t.Errorf("%v: error = %v, want errNoDate", name, err)
+		}
+		if !d.IsZero() {
+			t.Errorf("%v: date = %v, want the zero time", name, d)
+		}
+	}
+
+	d, err := parseDate("2020-13-45-bad")
+	if err == nil || err == errNoDate || !d.IsZero() {
+		t.Errorf("invalid date gave %v and %v, want a parse error and the zero time", d, err)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	testSite(t)
+	undated := writeSource(t, "sub/undated.md", "# Undated\n")
+	dated := writeSource(t, "2020-01-01-dated.md", "# Dated\n")
+
+	if err := prepare(); err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().In(timezone).Format("2006-01-02")
+	if _, err := os.Stat(filepath.Join(config.SourceDir, "sub", today+"-undated.md")); err != nil {
+		t.Errorf("undated file not renamed: %v", err)
+	}
+	if _, err := os.Stat(undated); !os.IsNotExist(err) {
+		t.Errorf("undated file still there: %v", err)
+	}
+	if _, err := os.Stat(dated); err != nil {
+		t.Errorf("dated file renamed: %v", err)
+	}
+}
+
+func TestFindTitle(t *testing.T) {
+	for _, tc := range []struct{ name, src, want string }{
+		{"code block first", "```sh\n# install\nmake\n```\n\ntext\n", ""},
+		{"heading after code", "```sh\n# install\n```\n\n# Real Title\n", "Real Title"},
+		{"tilde fence", "~~~\n# comment\n~~~\n# Title\n", "Title"},
+		{"indented fence", "  ```\n# comment\n  ```\n# Title\n", "Title"},
+		{"first heading of any level", "Intro\n\n## Sub Title\n\n# Later\n", "Sub Title"},
+	} {
+		if got := findTitle(strings.Split(tc.src, "\n")); got != tc.want {
+			t.Errorf("%v: title = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTitlePrefersFrontMatter(t *testing.T) {
+	testSite(t)
+	post, err := parseSourceFile(writeSource(t, "2020-01-01-post.md", "---\ntitle: Front Matter\n---\n```sh\n# install\n```\n\n# Heading\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Front Matter" {
+		t.Errorf("title = %q, want the front matter title", post.Title)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	testSite(t)
+	config.PerPage = 10
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `{{ .Number }}/{{ .Total }} {{ len .Posts }} prev={{ .PrevURL }} next={{ .NextURL }} first={{ (index .Posts 0).Title }}`)
+	for i := 1; i <= 25; i++ {
+		writeSource(t, fmt.Sprintf("2020-01-%02d-post.md", i), fmt.Sprintf("---\nslug: post-%d\n---\n# Post %d\n", i, i))
+	}
+	testBuild(t)
+
+	for p, want := range map[string]string{
+		"index.html":  "1/3 10 prev= next=http://example.com/page/2.html first=Post 25",
+		"page/2.html": "2/3 10 prev=http://example.com/ next=http://example.com/page/3.html first=Post 15",
+		"page/3.html": "3/3 5 prev=http://example.com/page/2.html next= first=Post 5",
+	} {
+		if got := readOutput(t, p); got != want {
+			t.Errorf("%v = %q, want %q", p, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "page", "4.html")); !os.IsNotExist(err) {
+		t.Errorf("page 4 written: %v", err)
+	}
+}
+
+func TestIndexPageCount(t *testing.T) {
+	testConfig(t)
+	for _, tc := range []struct{ perPage, posts, pages int }{
+		{0, 25, 1}, {10, 0, 1}, {10, 10, 1}, {10, 11, 2}, {10, 25, 3}, {1, 3, 3},
+	} {
+		config.PerPage = tc.perPage
+		if got := indexPageCount(tc.posts); got != tc.pages {
+			t.Errorf("%d posts at %d per page: %d pages, want %d", tc.posts, tc.perPage, got, tc.pages)
+		}
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "note.html"), `note: {{ .Title }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `post: {{ .Title }}`)
+	writeSource(t, "2020-01-01-note.md", "---\ntitle: A Note\nlayout: note\n---\nbody\n")
+	writeSource(t, "2020-01-02-article.md", "---\ntitle: An Article\n---\nbody\n")
+	testBuild(t)
+
+	if got := readOutput(t, "a-note.html"); got != "note: A Note" {
+		t.Errorf("post with a layout = %q", got)
+	}
+	if got := readOutput(t, "an-article.html"); got != "post: An Article" {
+		t.Errorf("post without a layout = %q", got)
+	}
+
+	// main.html without a post.html
+	if err := os.Remove(filepath.Join(config.TemplateDir, "post.html")); err != nil {
+		t.Fatal(err)
+	}
+	testBuild(t)
+	if got := readOutput(t, "an-article.html"); !strings.Contains(got, "<title>An Article</title>") {
+		t.Errorf("post without a layout or post.html = %q, want main.html", got)
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	testSite(t)
+	for layout, want := range map[string]string{
+		"missing":   `Unable to find layout "missing"`,
+		"../escape": `Invalid layout "../escape"`,
+	} {
+		src := writeSource(t, "2020-01-01-post.md", "---\nlayout: "+layout+"\n---\nbody\n")
+		_, err := parseSourceFile(src)
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), src) {
+			t.Errorf("layout %v: error = %v, want %v naming the post", layout, err, want)
+		}
+	}
+}
+
+func TestWordAndCharCount(t *testing.T) {
+	testSite(t)
+	for _, tc := range []struct {
+		name, content string
+		words, chars  int
+	}{
+		{"2020-01-01-ascii.md", "Hello *big* world.\n", 3, 16},
+		{"2020-01-02-cjk.md", "日本語のテキスト です\n", 2, 11},
+		{"2020-01-03-mixed.md", "Grüße, 世界!\n\nZweiter Absatz.\n", 4, 26},
+		{"2020-01-04-empty.md", "", 0, 0},
+	} {
+		post, err := parseSourceFile(writeSource(t, tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.WordCount != tc.words || post.CharCount != tc.chars {
+			t.Errorf("%v: %d words and %d chars, want %d and %d", tc.name, post.WordCount, post.CharCount, tc.words, tc.chars)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	testSite(t)
+	*dryRun = true
+	config.AutoDatePrefix = true
+	undated := writeSource(t, "undated.md", "# Undated\n")
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	writeFile(t, filepath.Join(config.StaticDir, "css", "site.css"), "body{}")
+
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.INFO)
+	if err := build(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(config.OutputDir); !os.IsNotExist(err) {
+		t.Errorf("dry run created OutputDir: %v", err)
+	}
+	if _, err := os.Stat(undated); err != nil {
+		t.Errorf("dry run renamed a source file: %v", err)
+	}
+	for _, want := range []string{
+		"Would write " + filepath.Join(config.OutputDir, "post.html"),
+		"Would write " + filepath.Join(config.OutputDir, "css", "site.css"),
+		"Would rename " + undated,
+		"Dry run, would write 2 posts, 1 index pages and 4 feeds",
+	} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, logged.String())
+		}
+	}
+}
+
+func TestNoAutoDatePrefix(t *testing.T) {
+	testSite(t)
+	undated := writeSource(t, "undated.md", "# Undated\n")
+	mtime := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := os.Chtimes(undated, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	testBuild(t)
+
+	if _, err := os.Stat(undated); err != nil {
+		t.Errorf("source renamed without AutoDatePrefix: %v", err)
+	}
+	files, _ := ioutil.ReadDir(config.SourceDir)
+	if len(files) != 1 {
+		t.Errorf("SourceDir holds %d files, want just the original", len(files))
+	}
+
+	post, err := parseSourceFile(undated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !post.Date.Equal(mtime) {
+		t.Errorf("date = %v, want the file's modification time %v", post.Date, mtime)
+	}
+}
+
+func TestAuthor(t *testing.T) {
+	testSite(t)
+	config.DefaultAuthor, config.DefaultAuthorEmail = "Site Owner", "owner@example.com"
+	for _, tc := range []struct{ name, content, author, email string }{
+		{"2020-01-01-own.md", "---\nauthor: Guest\nemail: guest@example.com\n---\nbody\n", "Guest", "guest@example.com"},
+		// the default email isn't credited to another author
+		{"2020-01-02-no-email.md", "---\nauthor: Guest\n---\nbody\n", "Guest", ""},
+		{"2020-01-03-default.md", "body\n", "Site Owner", "owner@example.com"},
+	} {
+		post, err := parseSourceFile(writeSource(t, tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Author != tc.author || post.AuthorEmail != tc.email {
+			t.Errorf("%v: author %q <%v>, want %q <%v>", tc.name, post.Author, post.AuthorEmail, tc.author, tc.email)
+		}
+	}
+
+	config.DefaultAuthor, config.DefaultAuthorEmail = "", ""
+	post, err := parseSourceFile(writeSource(t, "2020-01-04-anonymous.md", "body\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Author != "" || post.AuthorEmail != "" {
+		t.Errorf("author %q <%v> without a default", post.Author, post.AuthorEmail)
+	}
+}
+
+func TestMetaTags(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+	config.SiteTitle = "Site"
+	post := Post{Title: "Post", Slug: "post", Excerpt: "About it."}
+
+	meta := post.MetaTags()
+	want := MetaTags{"Post", "About it.", "http://example.com/post.html", "article", "", "Site", "summary"}
+	if meta != want {
+		t.Errorf("meta = %+v, want %+v", meta, want)
+	}
+
+	// the site default stands in for a missing image
+	config.DefaultImage = "/img/default.png"
+	if meta = post.MetaTags(); meta.Image != "http://example.com/img/default.png" || meta.TwitterCard != "summary_large_image" {
+		t.Errorf("meta with DefaultImage = %+v", meta)
+	}
+
+	for image, want := range map[string]string{
+		"img/own.png":                   "http://example.com/img/own.png",
+		"/img/own.png":                  "http://example.com/img/own.png",
+		"https://cdn.example.org/x.png": "https://cdn.example.org/x.png",
+	} {
+		post.Image = image
+		if got := post.MetaTags().Image; got != want {
+			t.Errorf("image %q resolved to %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestMetaTagsInPostPage(t *testing.T) {
+	testSite(t)
+	config.DefaultImage = "/img/default.png"
+	writeSource(t, "2020-01-01-post.md", "---\ntitle: Fish & Chips\nsummary: A \"quoted\" summary.\n---\nbody\n")
+	testBuild(t)
+
+	page := readOutput(t, "fish-chips.html")
+	for _, want := range []string{
+		`<meta property="og:title" content="Fish &amp; Chips">`,
+		`<meta property="og:description" content="A &#34;quoted&#34; summary.">`,
+		`<meta property="og:url" content="http://example.com/fish-chips.html">`,
+		`<meta property="og:image" content="http://example.com/img/default.png">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("post page lacks %v:\n%s", want, page)
+		}
+	}
+}
+
+func TestRelatePosts(t *testing.T) {
+	testConfig(t)
+	posts := testPosts(6)
+	for i, tags := range [][]string{
+		{"go", "web", "db"}, // post 0, the oldest
+		{"go", "web"},
+		{"go"},
+		{"Go", "Web", "DB"}, // same tags spelled differently
+		{"cooking"},
+		{"go", "web", "db"}, // newest
+	} {
+		posts[i].Tags = tags
+	}
+	sort.Sort(posts)
+	relatePosts(posts)
+
+	related := func(title string) string {
+		for _, p := range posts {
+			if p.Title == title {
+				var titles []string
+				for _, r := range p.RelatedPosts {
+					titles = append(titles, r.Title)
+				}
+				return strings.Join(titles, ",")
+			}
+		}
+		return ""
+	}
+
+	// most shared tags first, newer ones first on ties, never itself
+	for title, want := range map[string]string{
+		"Post 5": "Post 3,Post 0,Post 1",
+		"Post 0": "Post 5,Post 3,Post 1",
+		"Post 2": "Post 5,Post 3,Post 1",
+		"Post 4": "",
+	} {
+		if got := related(title); got != want {
+			t.Errorf("related to %v = %v, want %v", title, got, want)
+		}
+	}
+
+	config.RelatedCount = 1
+	relatePosts(posts)
+	if got := related("Post 5"); got != "Post 3" {
+		t.Errorf("related with RelatedCount 1 = %v, want Post 3", got)
+	}
+}
+
+func TestFuturePosts(t *testing.T) {
+	testSite(t)
+	tomorrow := time.Now().In(timezone).AddDate(0, 0, 1).Format("2006-01-02")
+	writeSource(t, "2020-01-01-now.md", "# Now\n")
+	writeSource(t, tomorrow+"-later.md", "# Later\n")
+
+	testBuild(t)
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "later.html")); !os.IsNotExist(err) {
+		t.Errorf("scheduled post written: %v", err)
+	}
+	for _, p := range []string{"index.html", "rss.xml", "sitemap.xml"} {
+		if page := readOutput(t, p); strings.Contains(page, "later") || strings.Contains(page, "Later") {
+			t.Errorf("scheduled post listed in %v", p)
+		}
+	}
+
+	*future = true
+	testBuild(t)
+	readOutput(t, "later.html")
+	for _, p := range []string{"index.html", "rss.xml", "sitemap.xml"} {
+		if !strings.Contains(readOutput(t, p), "later") {
+			t.Errorf("scheduled post missing from %v with -future", p)
+		}
+	}
+}
+
+func Test404(t *testing.T) {
+	testSite(t)
+	for i := 1; i <= 7; i++ {
+		writeSource(t, fmt.Sprintf("2020-01-%02d-post.md", i), fmt.Sprintf("---\nslug: post-%d\n---\n# Post %d\n", i, i))
+	}
+	testBuild(t)
+
+	page := readOutput(t, "404.html")
+	if !strings.Contains(page, "<title>Page not found</title>") || !strings.Contains(page, "latest posts on My Site") {
+		t.Errorf("404 page = %q", page)
+	}
+	// the five newest posts
+	if !strings.Contains(page, "Post 7") || !strings.Contains(page, "Post 3") || strings.Contains(page, "Post 2") {
+		t.Errorf("404 page doesn't list the newest five posts:\n%s", page)
+	}
+
+	// skipped without a template
+	if err := os.Remove(filepath.Join(config.TemplateDir, "404.html")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(config.OutputDir); err != nil {
+		t.Fatal(err)
+	}
+	testBuild(t)
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "404.html")); !os.IsNotExist(err) {
+		t.Errorf("404.html written without a template: %v", err)
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+	post := Post{Slug: "hello", Title: "Hello There", Date: time.Date(2021, 3, 7, 0, 0, 0, 0, time.UTC)}
+
+	for pattern, want := range map[string]string{
+		"":                         "hello.html",
+		"/:year/:month/:slug/":     "2021/03/hello/index.html",
+		":year/:month/:day/:title": "2021/03/07/hello-there.html",
+		"/posts/:slug.htm":         "posts/hello.htm",
+		"/../:slug/":               "hello/index.html",
+	} {
+		config.Permalink = pattern
+		if got := post.Path(); got != want {
+			t.Errorf("%q: path = %q, want %q", pattern, got, want)
+		}
+	}
+
+	config.Permalink = "/:year/:month/:slug/"
+	if got, want := post.URL(), "http://example.com/2021/03/hello/"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+}
+
+func TestPermalinkBuild(t *testing.T) {
+	testSite(t)
+	config.Permalink = "/:year/:month/:slug/"
+	writeSource(t, "2021-03-07-hello.md", "# Hello\n\nbody\n")
+	testBuild(t)
+
+	if !strings.Contains(readOutput(t, "2021/03/hello/index.html"), "body") {
+		t.Error("post not written below its permalink")
+	}
+	if !strings.Contains(readOutput(t, "index.html"), `href="http://example.com/2021/03/hello/"`) {
+		t.Error("index doesn't link the permalink")
+	}
+}
+
+func TestPrettyURLs(t *testing.T) {
+	testSite(t)
+	config.PrettyURLs = true
+	config.PerPage = 1
+	writeSource(t, "2020-01-01-first.md", "---\ntitle: First\ntags: [Go]\n---\nbody\n")
+	writeSource(t, "2020-01-02-second.md", "---\ntitle: Second\n---\nbody\n")
+	testBuild(t)
+
+	for _, p := range []string{"first/index.html", "second/index.html", "tags/go/index.html", "archive/index.html", "page/2/index.html"} {
+		readOutput(t, p)
+	}
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "first.html")); !os.IsNotExist(err) {
+		t.Errorf("first.html written with PrettyURLs: %v", err)
+	}
+
+	for p, links := range map[string][]string{
+		"index.html":         {"http://example.com/second/", "http://example.com/page/2/"},
+		"page/2/index.html":  {"http://example.com/first/"},
+		"tags/go/index.html": {"http://example.com/first/"},
+		"archive/index.html": {"http://example.com/first/", "http://example.com/second/"},
+	} {
+		page := readOutput(t, p)
+		for _, link := range links {
+			if !strings.Contains(page, `href="`+link+`"`) {
+				t.Errorf("%v doesn't link %v:\n%s", p, link, page)
+			}
+		}
+	}
+	if got := tagURL("Go"); got != "http://example.com/tags/go/" {
+		t.Errorf("tagURL = %q", got)
+	}
+}
+
+func TestBrokenTemplate(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	writeFile(t, filepath.Join(config.TemplateDir, "main.html"), "{{ .Title ")
+	writeFile(t, filepath.Join(config.TemplateDir, "archive.html"), "{{ range }}")
+
+	err := build(true)
+	if err == nil {
+		t.Fatal("build with broken templates succeeded")
+	}
+	for _, want := range []string{"Invalid templates", "main.html", "archive.html"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %v", err, want)
+		}
+	}
+	if _, err := os.Stat(config.OutputDir); !os.IsNotExist(err) {
+		t.Errorf("output written before the templates were checked: %v", err)
+	}
+}
+
+func TestRequiredTemplates(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-post.md", "---\ntitle: Post\ntags: [go]\n---\nbody\n")
+
+	// tag and archive pages are optional
+	for _, name := range []string{"tag.html", "archive.html", "posts.html", "404.html", "post.html"} {
+		if err := os.Remove(filepath.Join(config.TemplateDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testBuild(t)
+	readOutput(t, "post.html")
+	readOutput(t, "tags/go/feed.xml")
+	for _, p := range []string{"tags/go.html", "archive.html"} {
+		if _, err := os.Stat(filepath.Join(config.OutputDir, p)); !os.IsNotExist(err) {
+			t.Errorf("%v written without its template: %v", p, err)
+		}
+	}
+
+	// main, recent and feed aren't
+	for _, name := range requiredTemplates {
+		testSite(t)
+		writeSource(t, "2020-01-01-post.md", "# Post\n")
+		if err := os.Remove(filepath.Join(config.TemplateDir, name)); err != nil {
+			t.Fatal(err)
+		}
+		if err := build(true); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("build without %v: error = %v", name, err)
+		}
+	}
+}
+
+func TestTemplateCache(t *testing.T) {
+	testSite(t)
+	tmplPath := filepath.Join(config.TemplateDir, "cached.html")
+	writeFile(t, tmplPath, "first {{ . }}")
+
+	a, err := loadTemplate(tmplPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := loadTemplate(tmplPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("unchanged template parsed again")
+	}
+
+	// editing the template or a partial invalidates it
+	writeFile(t, tmplPath, "second {{ . }}")
+	touch(t, tmplPath)
+	if out, err := renderTemplate(tmplPath, "x"); err != nil || string(out) != "second x" {
+		t.Errorf("after an edit rendered %q, %v", out, err)
+	}
+	c, _ := loadTemplate(tmplPath)
+	touch(t, filepath.Join(config.TemplateDir, "partials", "header.html"))
+	if d, _ := loadTemplate(tmplPath); d == c {
+		t.Error("template not parsed again after a partial changed")
+	}
+
+	// as does adding a partial
+	writeFile(t, filepath.Join(config.TemplateDir, "partials", "extra.html"), `{{ define "extra" }}extra{{ end }}`)
+	writeFile(t, tmplPath, `{{ template "extra" }}`)
+	touch(t, tmplPath)
+	if out, err := renderTemplate(tmplPath, nil); err != nil || string(out) != "extra" {
+		t.Errorf("with a new partial rendered %q, %v", out, err)
+	}
+}
+
+func BenchmarkRenderTemplate(b *testing.B) {
+	testSite(b)
+	tmplPath := filepath.Join(config.TemplateDir, "main.html")
+	page := Page{"Title", "<p>content</p>"}
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := renderTemplate(tmplPath, page); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parsed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tmpl, err := parseTemplate(tmplPath)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := tmpl.Execute(ioutil.Discard, page); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestLogLevel(t *testing.T) {
+	testConfig(t)
+	for _, tc := range []struct {
+		level   string
+		verbose bool
+		want    string
+		known   bool
+	}{
+		{"", false, "info", true},
+		{"error", false, "error", true},
+		{"warning", false, "warning", true},
+		{"INFO", false, "info", true},
+		{"debug", false, "debug", true},
+		{"error", true, "warning", true},
+		{"info", true, "debug", true},
+		{"debug", true, "debug", true},
+		{"loud", false, "info", false},
+		{"loud", true, "debug", false},
+	} {
+		config.LogLevel, *verbose = tc.level, tc.verbose
+		if got, known := logLevel(); got != tc.want || known != tc.known {
+			t.Errorf("LogLevel %q with -v=%v: %v, %v, want %v, %v", tc.level, tc.verbose, got, known, tc.want, tc.known)
+		}
+	}
+}
+
+func TestFailedPosts(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-good.md", "# Good\n")
+	writeSource(t, "2020-01-02-broken.md", "---\ntitle: [unclosed\n---\nbody\n")
+	writeSource(t, "2020-01-03-fine.md", "# Fine\n")
+
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.INFO)
+	err := build(true)
+	if err == nil || err.Error() != "1 posts failed to build" {
+		t.Errorf("error = %v, want one failed post", err)
+	}
+	if !strings.Contains(logged.String(), "Built 2 posts, 1 failed") {
+		t.Errorf("log lacks the summary:\n%s", logged.String())
+	}
+
+	index := readOutput(t, "index.html")
+	if strings.Count(index, "<li>") != 2 || !strings.Contains(index, "Good") || !strings.Contains(index, "Fine") {
+		t.Errorf("index doesn't list just the good posts:\n%s", index)
+	}
+}
+
+func TestUnwrittenPosts(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ if eq .Title "Bad" }}{{ .NoSuchField }}{{ end }}{{ .Title }}`)
+	writeSource(t, "2020-01-01-good.md", "# Good\n")
+	writeSource(t, "2020-01-02-bad.md", "# Bad\n")
+
+	if err := build(true); err == nil {
+		t.Error("build succeeded with a post failing to render")
+	}
+	if index := readOutput(t, "index.html"); strings.Contains(index, "Bad") || !strings.Contains(index, "Good") {
+		t.Errorf("index lists the post that failed to render:\n%s", index)
+	}
+}
+
+func TestSiteTitle(t *testing.T) {
+	testSite(t)
+	config.SiteTitle = "Notes and Essays"
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+
+	if index := readOutput(t, "index.html"); !strings.Contains(index, "<title>Notes and Essays</title>") {
+		t.Errorf("index lacks the site title:\n%s", index)
+	}
+	if rss := readOutput(t, "rss.xml"); !strings.Contains(rss, "<title>Notes and Essays</title>") {
+		t.Errorf("rss lacks the site title:\n%s", rss)
+	}
+
+	for _, title := range []string{"", "   "} {
+		if err := loadConfig(t, "config.json", `{"SiteTitle": "`+title+`"}`); err != nil {
+			t.Fatal(err)
+		}
+		if config.SiteTitle != defaultSiteTitle {
+			t.Errorf("SiteTitle %q = %q, want %q", title, config.SiteTitle, defaultSiteTitle)
+		}
+	}
+}
+
+func TestSourceExtensions(t *testing.T) {
+	testSite(t)
+	config.SourceExtensions = []string{".md", ".markdown", ".mdown"}
+	writeSource(t, "2020-01-01-one.md", "body\n")
+	writeSource(t, "2020-01-02-two.markdown", "body\n")
+	writeSource(t, "sub/2020-01-03-three.mdown", "body\n")
+	writeSource(t, "notes.txt", "not a post\n")
+
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range srcFiles {
+		names = append(names, trimPath(f))
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "2020-01-01-one,2020-01-02-two,2020-01-03-three" {
+		t.Errorf("sources = %v", got)
+	}
+
+	testBuild(t)
+	for _, p := range []string{"2020-01-01-one.html", "2020-01-02-two.html", "sub/2020-01-03-three.html"} {
+		readOutput(t, p)
+	}
+}
+
+func TestSourceExtensionsConfig(t *testing.T) {
+	if err := loadConfig(t, "config.json", `{"SourceExtensions": ["md", ".markdown"]}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(config.SourceExtensions, ","); got != ".md,.markdown" {
+		t.Errorf("SourceExtensions = %v", got)
+	}
+	if err := loadConfig(t, "config.json", `{"SourceExtensions": [""]}`); err == nil {
+		t.Error("no error for an empty extension")
+	}
+}
+
+func TestPostIndex(t *testing.T) {
+	testSite(t)
+	config.PerPage = 10
+	for i := 1; i <= 30; i++ {
+		writeSource(t, fmt.Sprintf("2020-01-%02d-post.md", i), fmt.Sprintf("---\nslug: post-%d\n---\n# Post %d\n", i, i))
+	}
+	testBuild(t)
+
+	page := readOutput(t, "posts.html")
+	for i := 1; i <= 30; i++ {
+		if !strings.Contains(page, fmt.Sprintf(`href="http://example.com/post-%d.html"`, i)) {
+			t.Errorf("posts.html doesn't link post %d", i)
+		}
+	}
+	if n := strings.Count(page, "<li>"); n != 30 {
+		t.Errorf("posts.html lists %d posts, want 30", n)
+	}
+	if i, j := strings.Index(page, "Post 30<"), strings.Index(page, "Post 1<"); i < 0 || j < 0 || i > j {
+		t.Error("posts.html isn't newest first")
+	}
+}
+
+func TestCopySource(t *testing.T) {
+	testSite(t)
+	if config.CopySource {
+		t.Error("CopySource on by default")
+	}
+	writeSource(t, "blog/2020-01-01-post.md", "---\ntitle: Post\ntags: [go]\n---\n# Heading\n\nbody\n")
+	testBuild(t)
+	if _, err := os.Stat(filepath.Join(config.OutputDir, "blog", "post.md")); !os.IsNotExist(err) {
+		t.Errorf("source copied without CopySource: %v", err)
+	}
+
+	config.CopySource = true
+	testBuild(t)
+	if got := readOutput(t, "blog/post.md"); got != "# Heading\n\nbody\n" {
+		t.Errorf("copied source = %q, want it without front matter", got)
+	}
+
+	config.PrettyURLs = true
+	testBuild(t)
+	readOutput(t, "blog/post.md")
+}
+
+func TestCheckOutputDir(t *testing.T) {
+	testConfig(t)
+	config.OutputDir = filepath.Join(t.TempDir(), "missing", "public")
+	if err := checkOutputDir(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(config.OutputDir); err != nil || !info.IsDir() {
+		t.Errorf("OutputDir not created: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(config.OutputDir); len(files) != 0 {
+		t.Errorf("check left %d files behind", len(files))
+	}
+}
+
+func TestCheckOutputDirReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	testConfig(t)
+	config.OutputDir = t.TempDir()
+	if err := os.Chmod(config.OutputDir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(config.OutputDir, 0755)
+
+	err := checkOutputDir()
+	if err == nil || !strings.Contains(err.Error(), "is not writable") || !strings.Contains(err.Error(), config.OutputDir) {
+		t.Errorf("error = %v, want one saying OutputDir isn't writable", err)
+	}
+}
+
+func TestCheckOutputDirFile(t *testing.T) {
+	testConfig(t)
+	config.OutputDir = filepath.Join(t.TempDir(), "file")
+	writeFile(t, config.OutputDir, "not a directory")
+	if err := checkOutputDir(); err == nil || !strings.Contains(err.Error(), "Unable to create OutputDir") {
+		t.Errorf("error = %v, want Unable to create OutputDir", err)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	d := time.Date(2020, 3, 4, 15, 6, 7, 0, time.UTC)
+	for layout, want := range map[string]string{
+		"":            "Mar 4, 2020",
+		"short":       "Mar 4, 2020",
+		"long":        "March 4, 2020",
+		"LONG":        "March 4, 2020",
+		"iso":         "2020-03-04",
+		"rfc3339":     "2020-03-04T15:06:07Z",
+		"02/01/2006":  "04/03/2020",
+		"Monday 3:04": "Wednesday 3:06",
+	} {
+		if got := formatDate(layout, d); got != want {
+			t.Errorf("formatDate(%q) = %q, want %q", layout, got, want)
+		}
+	}
+	if got := formatDate("long", time.Time{}); got != "" {
+		t.Errorf("formatDate of zero time = %q, want empty", got)
+	}
+}
+
+func TestFormattedDate(t *testing.T) {
+	testSite(t)
+	config.DateFormat = "long"
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ .FormattedDate }}|{{ .Date | dateFormat "iso" }}`)
+	writeSource(t, "2020-03-04-post.md", "# Post\n")
+	testBuild(t)
+
+	if got, want := readOutput(t, "post.html"), "March 4, 2020|2020-03-04"; got != want {
+		t.Errorf("post page = %q, want %q", got, want)
+	}
+}
+
+// render the template text, written as name in TemplateDir, with data
+func renderString(t *testing.T, name, text string, data interface{}) (string, error) {
+	t.Helper()
+	p := filepath.Join(config.TemplateDir, name)
+	writeFile(t, p, text)
+	out, err := renderTemplate(p, data)
+	return string(out), err
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	testSite(t)
+	d := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	for i, test := range []struct {
+		text string
+		want string
+	}{
+		{`{{ lower "Hello World" }}`, "hello world"},
+		{`{{ upper "Hello World" }}`, "HELLO WORLD"},
+		{`{{ truncate 5 "Hello World" }}`, "Hell…"},
+		{`{{ "Hi" | truncate 5 }}`, "Hi"},
+		{`{{ dateFormat "long" .Date }}`, "March 4, 2020"},
+		{`{{ .Date | dateFormat "iso" }}`, "2020-03-04"},
+		{`{{ urlize "Hello, World!" }}`, "hello-world"},
+		{`{{ .Title | urlize | upper }}`, "MY-POST"},
+	} {
+		got, err := renderString(t, fmt.Sprintf("funcs%d.html", i), test.text, Post{Title: "My Post", Date: d})
+		if err != nil {
+			t.Errorf("%v: %v", test.text, err)
+		} else if got != test.want {
+			t.Errorf("%v = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTemplateUnknownFunc(t *testing.T) {
+	testSite(t)
+	_, err := renderString(t, "unknown.html", `{{ shout .Title }}`, Post{})
+	if err == nil || !strings.Contains(err.Error(), `function "shout" not defined`) {
+		t.Errorf("error = %v, want an undefined function parse error", err)
+	}
+}
+
+func TestOutputOverride(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ .Content }}`)
+	writeSource(t, "feeds/2020-01-01-custom.md", "---\ntitle: Custom\noutput: custom.xml\n---\n<channel/>\n")
+	writeSource(t, "2020-01-02-humans.md", "---\ntitle: Humans\noutput: ./text/humans.txt\n---\nteam\n")
+	testBuild(t)
+
+	if got := readOutput(t, "feeds/custom.xml"); !strings.Contains(got, "<channel/>") {
+		t.Errorf("feeds/custom.xml = %q", got)
+	}
+	if got := readOutput(t, "text/humans.txt"); !strings.Contains(got, "team") {
+		t.Errorf("text/humans.txt = %q", got)
+	}
+	if outputExistsAt(t, "feeds/custom.html") || outputExistsAt(t, "humans.html") {
+		t.Error("html page written along with the output override")
+	}
+}
+
+func TestOutputOverrideInvalid(t *testing.T) {
+	testSite(t)
+	for _, output := range []string{"../evil.html", "a/../../evil.html", "/etc/evil", "..", "."} {
+		p := writeSource(t, "sub/2020-01-01-post.md", "---\ntitle: Post\noutput: "+output+"\n---\nbody\n")
+		if _, err := parseSourceFile(p); err == nil || !strings.Contains(err.Error(), "Invalid output") {
+			t.Errorf("output %q: error = %v, want it rejected", output, err)
+		}
+	}
+}
+
+func TestBuildStats(t *testing.T) {
+	testSite(t)
+	for _, name := range []string{"a", "b", "c"} {
+		writeSource(t, "2020-01-01-"+name+".md", "---\ntitle: "+name+"\n---\none two three\n")
+	}
+	testBuild(t)
+
+	if stats.posts != 3 || stats.words != 9 {
+		t.Errorf("counted %d posts and %d words, want 3 and 9", stats.posts, stats.words)
+	}
+	if stats.elapsed <= 0 {
+		t.Errorf("elapsed = %v, want it timed", stats.elapsed)
+	}
+	if stats.files < 3 || stats.bytes <= 0 {
+		t.Errorf("counted %d files of %d bytes written", stats.files, stats.bytes)
+	}
+	if got := statsSummary(); !strings.HasPrefix(got, "Built 3 posts (9 words) in ") {
+		t.Errorf("summary = %q", got)
+	}
+
+	// every build counts from zero
+	files := stats.files
+	testBuild(t)
+	if stats.posts != 3 || stats.files != files {
+		t.Errorf("second build counted %d posts and %d files, want 3 and %d", stats.posts, stats.files, files)
+	}
+}
+
+func TestConfigResolve(t *testing.T) {
+	testConfig(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, name := range []string{"content", "templates"} {
+		if err := os.Mkdir(name, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := Config{SourceDir: "content", TemplateDir: "./templates/", OutputDir: "public", StaticDir: "../static", DataFile: "data.json", DataDir: "data"}
+	if err := c.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		SourceDir:   filepath.Join(dir, "content"),
+		TemplateDir: filepath.Join(dir, "templates"),
+		OutputDir:   filepath.Join(dir, "public"),
+		StaticDir:   filepath.Join(filepath.Dir(dir), "static"),
+		DataFile:    filepath.Join(dir, "data.json"),
+		DataDir:     filepath.Join(dir, "data"),
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("resolved to %+v, want %+v", c, want)
+	}
+
+	// absolute paths stay as they are
+	if err := c.resolve(); err != nil || !reflect.DeepEqual(c, want) {
+		t.Errorf("resolving again gave %+v, %v", c, err)
+	}
+}
+
+func TestConfigResolveMissing(t *testing.T) {
+	testConfig(t)
+	t.Chdir(t.TempDir())
+	writeFile(t, "templates", "not a directory")
+
+	c := Config{SourceDir: "content", TemplateDir: "templates", OutputDir: "public"}
+	err := c.resolve()
+	if err == nil {
+		t.Fatal("no error for missing directories")
+	}
+	for _, want := range []string{"SourceDir", "content", "TemplateDir", "templates"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't name %v", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "OutputDir") {
+		t.Errorf("error %q names the OutputDir the build creates", err)
+	}
+}
+
+// report whether the titles appear in s in the given order
+func inOrder(s string, titles ...string) bool {
+	last := -1
+	for _, title := range titles {
+		i := strings.Index(s, title)
+		if i <= last {
+			return false
+		}
+		last = i
+	}
+	return true
+}
+
+func TestPinned(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `{{ range .Posts }}[{{ .Title }}]{{ end }}`)
+	writeSource(t, "2020-01-01-old.md", "---\ntitle: Old\npinned: true\n---\nbody\n")
+	writeSource(t, "2020-01-02-middle.md", "---\ntitle: Middle\n---\nbody\n")
+	writeSource(t, "2020-01-03-new.md", "---\ntitle: New\n---\nbody\n")
+	testBuild(t)
+
+	if got, want := readOutput(t, "index.html"), "[Old][New][Middle]"; got != want {
+		t.Errorf("index = %q, want %q", got, want)
+	}
+	for _, p := range []string{"rss.xml", "atom.xml"} {
+		if got := readOutput(t, p); !inOrder(got, "<title>New", "<title>Middle", "<title>Old") {
+			t.Errorf("%v not newest first:\n%s", p, got)
+		}
+	}
+}
+
+// titles of posts in order
+func postTitles(posts Posts) string {
+	var titles []string
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestSortBy(t *testing.T) {
+	testConfig(t)
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	posts := Posts{
+		{Title: "banana", Date: day(2)},
+		{Title: "Cherry", Date: day(3)},
+		{Title: "apple", Date: day(1), Pinned: true},
+		{Title: "Apple", Date: day(4)},
+	}
+
+	for sortBy, want := range map[string]string{
+		"date-desc": "Apple,Cherry,banana,apple",
+		"date-asc":  "apple,banana,Cherry,Apple",
+		"title":     "Apple,apple,banana,Cherry",
+	} {
+		config.SortBy = sortBy
+		sort.Sort(listingOrder{posts, false})
+		if got := postTitles(posts); got != want {
+			t.Errorf("%v: %v, want %v", sortBy, got, want)
+		}
+		sort.Sort(listingOrder{posts, true})
+		if got := postTitles(posts); !strings.HasPrefix(got, "apple,") {
+			t.Errorf("%v with pinned posts: %v, want the pinned post first", sortBy, got)
+		}
+	}
+
+	// feeds and navigation stay newest first
+	config.SortBy = "title"
+	sort.Sort(posts)
+	if got, want := postTitles(posts), "Apple,Cherry,banana,apple"; got != want {
+		t.Errorf("Posts order with SortBy title: %v, want %v", got, want)
+	}
+}
+
+func TestSortByConfig(t *testing.T) {
+	if err := loadConfig(t, "config.json", `{}`); err != nil || config.SortBy != "date-desc" {
+		t.Errorf("default SortBy = %q, %v", config.SortBy, err)
+	}
+	if err := loadConfig(t, "config.json", `{"SortBy": "weight"}`); err == nil || !strings.Contains(err.Error(), "weight") {
+		t.Errorf("error = %v, want one naming the invalid SortBy", err)
+	}
+}
+
+func TestSortByBuild(t *testing.T) {
+	testSite(t)
+	config.SortBy = "title"
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `{{ range .Posts }}[{{ .Title }}]{{ end }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "posts.html"), `{{ range . }}[{{ .Title }}]{{ end }}`)
+	writeSource(t, "2020-01-01-b.md", "---\ntitle: B\n---\nbody\n")
+	writeSource(t, "2020-01-02-a.md", "---\ntitle: A\n---\nbody\n")
+	writeSource(t, "2020-01-03-c.md", "---\ntitle: C\n---\nbody\n")
+	testBuild(t)
+
+	for _, p := range []string{"index.html", "posts.html"} {
+		if got := readOutput(t, p); !strings.Contains(got, "[A][B][C]") {
+			t.Errorf("%v = %q, want posts by title", p, got)
+		}
+	}
+}
+
+func TestSameDateOrder(t *testing.T) {
+	testConfig(t)
+	d := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	posts := Posts{
+		{Title: "Beta", Date: d, Source: "content/b.md"},
+		{Title: "Alpha", Date: d, Source: "content/z.md"},
+		{Title: "Alpha", Date: d, Source: "content/a.md"},
+	}
+
+	// every starting order ends the same
+	want := "Alpha content/a.md,Alpha content/z.md,Beta content/b.md"
+	for i := 0; i < 6; i++ {
+		shuffled := append(Posts(nil), posts...)
+		shuffled[0], shuffled[i%3] = shuffled[i%3], shuffled[0]
+		if i >= 3 {
+			shuffled[1], shuffled[2] = shuffled[2], shuffled[1]
+		}
+		sort.Sort(shuffled)
+		var got []string
+		for _, post := range shuffled {
+			got = append(got, post.Title+" "+post.Source)
+		}
+		if strings.Join(got, ",") != want {
+			t.Errorf("order %d sorted to %v, want %v", i, strings.Join(got, ","), want)
+		}
+	}
+}
+
+func TestSameDateBuild(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `{{ range .Posts }}[{{ .Title }}]{{ end }}`)
+	for _, name := range []string{"c", "a", "b"} {
+		writeSource(t, "2020-01-01-"+name+".md", "---\ntitle: "+strings.ToUpper(name)+"\ndate: 2020-01-01T12:00:00Z\n---\nbody\n")
+	}
+
+	// repeated builds give the same output
+	for i := 0; i < 3; i++ {
+		testBuild(t)
+		if got, want := readOutput(t, "index.html"), "[A][B][C]"; got != want {
+			t.Fatalf("build %d: index = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	fm, _, err := parseFrontMatter([]byte("---\ntitle: T\ndate: 2020-01-01\ntags: [a]\ndraft: true\nsubtitle: Sub\ncount: 3\n---\nbody\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"subtitle": "Sub", "count": 3}
+	if !reflect.DeepEqual(fm.Params, want) {
+		t.Errorf("Params = %#v, want %#v", fm.Params, want)
+	}
+	if fm.Title != "T" || !fm.Draft || len(fm.Tags) != 1 {
+		t.Errorf("reserved keys not in their fields: %+v", fm)
+	}
+	for key := range reservedFrontMatter {
+		if _, ok := fm.Params[key]; ok {
+			t.Errorf("reserved key %v in Params", key)
+		}
+	}
+}
+
+func TestParamsInTemplate(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ .Params.subtitle }}|{{ .Params.hero.image }}|{{ with .Params.missing }}set{{ end }}`)
+	writeSource(t, "2020-01-01-post.md", "---\ntitle: Post\nsubtitle: A subtitle\nhero:\n  image: /img/hero.png\n---\nbody\n")
+	testBuild(t)
+
+	if got, want := readOutput(t, "post.html"), "A subtitle|/img/hero.png|"; got != want {
+		t.Errorf("post page = %q, want %q", got, want)
+	}
+}
+
+func TestBaseLayout(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "base.html"),
+		`<html><title>{{ block "title" . }}{{ siteTitle }}{{ end }}</title><body>{{ block "content" . }}default{{ end }}</body></html>`)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"),
+		`{{ define "title" }}{{ .Title }}{{ end }}{{ define "content" }}<article>{{ .Content }}</article>{{ end }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `standalone {{ len .Posts }}`)
+	writeSource(t, "2020-01-01-post.md", "# Post\n\nbody\n")
+	testBuild(t)
+
+	if got, want := readOutput(t, "post.html"), "<html><title>Post</title><body><article><h1 id=\"post\">Post</h1>\n\n<p>body</p>\n</article></body></html>"; got != want {
+		t.Errorf("post page =\n%q\nwant\n%q", got, want)
+	}
+	// templates without a content block stand alone
+	if got := readOutput(t, "index.html"); got != "standalone 1" {
+		t.Errorf("index = %q", got)
+	}
+
+	// the base renders on its own with its defaults
+	out, err := renderTemplate(filepath.Join(config.TemplateDir, "base.html"), nil)
+	if err != nil || string(out) != "<html><title>My Site</title><body>default</body></html>" {
+		t.Errorf("base.html = %q, %v", out, err)
+	}
+}
+
+func TestBaseLayoutMissing(t *testing.T) {
+	testSite(t)
+	if err := os.Remove(filepath.Join(config.TemplateDir, "base.html")); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	_, err := renderString(t, "page.html", `{{ define "content" }}x{{ end }}`, nil)
+	if err == nil || !strings.Contains(err.Error(), "Unable to extend base.html") {
+		t.Errorf("error = %v, want base.html reported missing", err)
+	}
+}
+
+func TestNormalizeSource(t *testing.T) {
+	for in, want := range map[string]string{
+		"\xef\xbb\xbf# Title\n":       "# Title\n",
+		"# Title\r\n\r\nbody\r\n":     "# Title\n\nbody\n",
+		"\xef\xbb\xbf---\r\nx: 1\r\n": "---\nx: 1\n",
+		"mid\xef\xbb\xbfdle\rkept\n":  "mid\xef\xbb\xbfdle\rkept\n",
+	} {
+		if got := string(normalizeSource([]byte(in))); got != want {
+			t.Errorf("normalizeSource(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBOMAndCRLFSources(t *testing.T) {
+	testSite(t)
+	for name, src := range map[string]string{
+		"2020-01-01-bom.md":         "\xef\xbb\xbf# BOM Title\n\nbody text\n",
+		"2020-01-02-crlf.md":        "# CRLF Title\r\n\r\nbody\r\ntext\r\n",
+		"2020-01-03-frontmatter.md": "\xef\xbb\xbf---\r\ntitle: Front Title\r\ntags: [a]\r\n---\r\nbody text\r\n",
+	} {
+		post, err := parseSourceFile(writeSource(t, name, src))
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if !strings.HasSuffix(post.Title, " Title") || strings.ContainsAny(post.Title, "\r\ufeff#") {
+			t.Errorf("%v: title %q", name, post.Title)
+		}
+		if strings.ContainsAny(post.Content, "\r\ufeff") || !strings.Contains(post.Content, "body") {
+			t.Errorf("%v: content %q", name, post.Content)
+		}
+	}
+}
+
+func TestLinkSeries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	// parts published out of order, newest first like the build sorts them
+	posts := Posts{
+		{Title: "Intro", Series: "Learning Go", SeriesPart: 1, Date: day(5)},
+		{Title: "Other", Date: day(4)},
+		{Title: "Finale", Series: "learning go", SeriesPart: 3, Date: day(3)},
+		{Title: "Middle", Series: "Learning Go", SeriesPart: 2, Date: day(1)},
+	}
+	linkSeries(posts)
+
+	title := func(p *Post) string {
+		if p == nil {
+			return ""
+		}
+		return p.Title
+	}
+	for i, want := range []struct {
+		position   int
+		prev, next string
+	}{
+		{1, "", "Middle"},
+		{0, "", ""},
+		{3, "Middle", ""},
+		{2, "Intro", "Finale"},
+	} {
+		p := posts[i]
+		total := 3
+		if want.position == 0 {
+			total = 0
+		}
+		if p.SeriesPosition != want.position || p.SeriesTotal != total || title(p.SeriesPrev) != want.prev || title(p.SeriesNext) != want.next {
+			t.Errorf("%v: part %d of %d, prev %q, next %q, want part %d of %d, prev %q, next %q", p.Title,
+				p.SeriesPosition, p.SeriesTotal, title(p.SeriesPrev), title(p.SeriesNext), want.position, total, want.prev, want.next)
+		}
+	}
+}
+
+func TestSeriesNav(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-03-one.md", "---\ntitle: One\nseries: Tutorial\npart: 1\n---\nbody\n")
+	writeSource(t, "2020-01-01-two.md", "---\ntitle: Two\nseries: Tutorial\npart: 2\n---\nbody\n")
+	writeSource(t, "2020-01-02-three.md", "---\ntitle: Three\nseries: Tutorial\npart: 3\n---\nbody\n")
+	writeSource(t, "2020-01-04-alone.md", "---\ntitle: Alone\n---\nbody\n")
+	testBuild(t)
+
+	for p, want := range map[string][]string{
+		"one.html":   {"Part 1 of 3 in Tutorial", `<a href="http://example.com/two.html">Next: Two</a>`},
+		"two.html":   {"Part 2 of 3 in Tutorial", `<a href="http://example.com/one.html">Previous: One</a>`, `<a href="http://example.com/three.html">Next: Three</a>`},
+		"three.html": {"Part 3 of 3 in Tutorial", `<a href="http://example.com/two.html">Previous: Two</a>`},
+	} {
+		page := readOutput(t, p)
+		for _, w := range want {
+			if !strings.Contains(page, w) {
+				t.Errorf("%v lacks %v:\n%s", p, w, page)
+			}
+		}
+	}
+	if strings.Contains(readOutput(t, "one.html"), "Previous:") || strings.Contains(readOutput(t, "three.html"), "Next:") {
+		t.Error("navigation past the ends of the series")
+	}
+	if strings.Contains(readOutput(t, "alone.html"), `class="series"`) {
+		t.Error("series navigation on a post outside any series")
+	}
+}
+
+func TestEnvPrecedence(t *testing.T) {
+	t.Setenv("INSTIGATOR_OUTPUTDIR", "env-out")
+	t.Setenv("INSTIGATOR_PERPAGE", "7")
+	if err := loadConfig(t, "config.json", `{"OutputDir": "file-out", "PerPage": 3}`); err != nil {
+		t.Fatal(err)
+	}
+	if config.OutputDir != "env-out" || config.PerPage != 7 {
+		t.Errorf("got %v and %v, want environment to beat the config file", config.OutputDir, config.PerPage)
+	}
+
+	*outputDir = "flag-out"
+	applyFlags()
+	if config.OutputDir != "flag-out" {
+		t.Errorf("OutputDir = %v, want the flag to beat the environment", config.OutputDir)
+	}
+}
+
+func TestEnvTypes(t *testing.T) {
+	t.Setenv("INSTIGATOR_MINIFY", "true")
+	t.Setenv("INSTIGATOR_ROBOTSDISALLOW", `["/a/", "/b/"]`)
+	t.Setenv("INSTIGATOR_TAXONOMIES", `{"categories": "category"}`)
+	if err := loadConfig(t, "config.json", `{"RobotsDisallow": ["/file/"]}`); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Minify || strings.Join(config.RobotsDisallow, ",") != "/a/,/b/" {
+		t.Errorf("got Minify %v and RobotsDisallow %v", config.Minify, config.RobotsDisallow)
+	}
+	// checked like the config file, tags still added
+	if want := map[string]string{"tags": "tags", "categories": "category"}; !reflect.DeepEqual(config.Taxonomies, want) {
+		t.Errorf("Taxonomies = %v, want %v", config.Taxonomies, want)
+	}
+
+	// the default applies without the variable
+	if err := loadConfig(t, "config.json", `{}`); err != nil || config.OutputDir != "public" {
+		t.Errorf("OutputDir = %v, %v, want the default", config.OutputDir, err)
+	}
+}
+
+func TestEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"INSTIGATOR_PERPAGE":        "many",
+		"INSTIGATOR_MINIFY":         "maybe",
+		"INSTIGATOR_ROBOTSDISALLOW": "/a/",
+	} {
+		t.Run(name, func(t *testing.T) {
+			testConfig(t)
+			t.Setenv(name, value)
+			p := filepath.Join(t.TempDir(), "config.json")
+			writeFile(t, p, `{}`)
+			if err := readConfig(p); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("error = %v, want one naming %v", err, name)
+			}
+		})
+	}
+}
+
+func TestModified(t *testing.T) {
+	testSite(t)
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	p := writeSource(t, "2020-01-01-post.md", "# Post\n")
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	post, err := parseSourceFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !post.Modified.Equal(mtime) {
+		t.Errorf("Modified = %v, want the file mtime %v", post.Modified, mtime)
+	}
+
+	// front matter beats the mtime
+	p = writeSource(t, "2020-01-01-post.md", "---\ntitle: Post\nlastmod: 2020-02-03\n---\nbody\n")
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if post, err = parseSourceFile(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := post.Modified.Format("2006-01-02"); got != "2020-02-03" {
+		t.Errorf("Modified = %v, want the lastmod from front matter", got)
+	}
+
+	// never before the post date
+	early := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	p = writeSource(t, "2020-01-01-post.md", "# Post\n")
+	if err := os.Chtimes(p, early, early); err != nil {
+		t.Fatal(err)
+	}
+	if post, err = parseSourceFile(p); err != nil {
+		t.Fatal(err)
+	}
+	if !post.Modified.Equal(post.Date) {
+		t.Errorf("Modified = %v, want the post date %v", post.Modified, post.Date)
+	}
+}
+
+func TestModifiedBuild(t *testing.T) {
+	testSite(t)
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ .FormattedModified }}`)
+	p := writeSource(t, "2020-01-01-post.md", "# Post\n")
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	testBuild(t)
+
+	if got := readOutput(t, "post.html"); got != "Jun 7, 2021" {
+		t.Errorf("post page = %q, want the modification date", got)
+	}
+	if got := readOutput(t, "sitemap.xml"); !strings.Contains(got, "<lastmod>2021-06-07</lastmod>") {
+		t.Errorf("sitemap lacks the modification date:\n%s", got)
+	}
+}
+
+// writer passing on one byte at a time, so unserialized writes interleave
+type tricklingWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *tricklingWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.buf.WriteByte(b)
+		runtime.Gosched()
+	}
+	return len(p), nil
+}
+
+func TestSyncWriter(t *testing.T) {
+	testConfig(t)
+	out := &tricklingWriter{}
+	log = llog.New(&syncWriter{w: out}, llog.DEBUG)
+
+	const workers, lines = 20, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				log.Infof("worker %02d line %02d done", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got := strings.Split(strings.TrimSuffix(out.buf.String(), "\n"), "\n")
+	if len(got) != workers*lines {
+		t.Fatalf("%d lines, want %d", len(got), workers*lines)
+	}
+	seen := make(map[string]bool)
+	for _, line := range got {
+		var i, j int
+		if n, err := fmt.Sscanf(line, "worker %02d line %02d done", &i, &j); n != 2 || err != nil || !strings.HasSuffix(line, " done") {
+			t.Fatalf("garbled line %q", line)
+		}
+		seen[line] = true
+	}
+	if len(seen) != workers*lines {
+		t.Errorf("%d distinct lines, want %d", len(seen), workers*lines)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	testSite(t)
+	config.Exclude = []string{"notes", "drafts/wip/", "*.tmp.md", "_*"}
+	for _, name := range []string{
+		"2020-01-01-kept.md",
+		"sub/2020-01-02-nested.md",
+		"drafts/2020-01-03-ready.md",
+		"notes/2020-01-04-note.md",
+		"sub/notes/2020-01-05-deep-note.md",
+		"drafts/wip/2020-01-06-wip.md",
+		"2020-01-07-scratch.tmp.md",
+		"_private/2020-01-08-hidden.md",
+		"sub/_2020-01-09-underscore.md",
+	} {
+		writeSource(t, name, "# Post\n")
+	}
+
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range srcFiles {
+		rel, _ := filepath.Rel(config.SourceDir, f)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), "2020-01-01-kept.md,drafts/2020-01-03-ready.md,sub/2020-01-02-nested.md"; got != want {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+
+	// paths outside SourceDir are never excluded
+	if excluded(filepath.Join(filepath.Dir(config.SourceDir), "notes")) {
+		t.Error("path outside SourceDir excluded")
+	}
+}
+
+func TestExcludeConfig(t *testing.T) {
+	if err := loadConfig(t, "config.json", `{"Exclude": ["notes", "*.tmp"]}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(t, "config.json", `{"Exclude": ["[notes"]}`); err == nil || !strings.Contains(err.Error(), "[notes") {
+		t.Errorf("error = %v, want one naming the bad pattern", err)
+	}
+}
+
+func TestIndexData(t *testing.T) {
+	testSite(t)
+	config.SiteTitle = "Home Page"
+	config.PerPage = 1
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"),
+		`{{ .Site.Title }}|{{ .Title }}|{{ len .AllPosts }}|{{ range .AllPosts }}{{ if .Pinned }}featured {{ .Title }}{{ end }}{{ end }}|{{ range .Posts }}recent {{ .Title }}{{ end }}|{{ range .AllPosts }}{{ if .Tags }}{{ index .Tags 0 }}:{{ .Title }} {{ end }}{{ end }}`)
+	writeSource(t, "2020-01-01-old.md", "---\ntitle: Old\npinned: true\n---\nbody\n")
+	writeSource(t, "2020-01-02-new.md", "---\ntitle: New\ntags: [go]\n---\nbody\n")
+	testBuild(t)
+
+	for p, want := range map[string]string{
+		"index.html":  "Home Page|Home Page|2|featured Old|recent Old|go:New ",
+		"page/2.html": "Home Page|Home Page|2|featured Old|recent New|go:New ",
+	} {
+		if got := readOutput(t, p); got != want {
+			t.Errorf("%v = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestIndexWithoutTemplate(t *testing.T) {
+	testSite(t)
+	if err := os.Remove(filepath.Join(config.TemplateDir, "index.html")); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(config.TemplateDir, "recent.html"), `{{ range .Posts }}<li>{{ .Title }}</li>{{ end }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "main.html"), `<main>{{ .Content }}</main>`)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+
+	// recent.html tucked into main.html
+	if got, want := readOutput(t, "index.html"), "<main><li>Post</li></main>"; got != want {
+		t.Errorf("index = %q, want %q", got, want)
+	}
+}
+
+// parse the source file, returning the post and the warnings logged
+func parseLogged(t *testing.T, name string) (*Post, string, error) {
+	t.Helper()
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.WARNING)
+	post, err := parseSourceFile(name)
+	log = llog.New(ioutil.Discard, llog.ERROR)
+	return post, logged.String(), err
+}
+
+func TestDateMismatch(t *testing.T) {
+	testSite(t)
+
+	// matching dates, at any time of day
+	for _, date := range []string{"2022-01-01", "2022-01-01T23:30:00", "2022-01-01T10:00:00+09:00"} {
+		post, warnings, err := parseLogged(t, writeSource(t, "2022-01-01-post.md", "---\ntitle: Post\ndate: "+date+"\n---\nbody\n"))
+		if err != nil || warnings != "" {
+			t.Errorf("date %v: warned %q, %v", date, warnings, err)
+		} else if post.Date.Format("2006-01-02") != "2022-01-01" {
+			t.Errorf("date %v: got %v", date, post.Date)
+		}
+	}
+
+	// front matter wins with a warning
+	name := writeSource(t, "2022-01-01-post.md", "---\ntitle: Post\ndate: 2023-01-01\n---\nbody\n")
+	post, warnings, err := parseLogged(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Date.Format("2006-01-02") != "2023-01-01" {
+		t.Errorf("date = %v, want the front matter one", post.Date)
+	}
+	if !strings.Contains(warnings, "File name date 2022-01-01 differs from front matter date 2023-01-01") || !strings.Contains(warnings, name) {
+		t.Errorf("warnings = %q", warnings)
+	}
+
+	// only one date, nothing to compare
+	if _, warnings, err := parseLogged(t, writeSource(t, "undated.md", "---\ntitle: Undated\ndate: 2023-01-01\n---\nbody\n")); err != nil || warnings != "" {
+		t.Errorf("undated file name: warned %q, %v", warnings, err)
+	}
+
+	// an error with StrictDates
+	config.StrictDates = true
+	if _, _, err := parseLogged(t, name); err == nil || !strings.Contains(err.Error(), "differs") {
+		t.Errorf("error = %v, want the mismatch with StrictDates", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// href attribute value in rendered html
+var hrefPattern = regexp.MustCompile(`\bhref=["']([^"']*)["']`)
+
+// internal links in post contents that don't lead to a file of the current
+// build, one message per link naming the post
+func findBrokenLinks(posts Posts) []string {
+	var broken []string
+	for _, post := range posts {
+		for _, m := range hrefPattern.FindAllStringSubmatch(post.Content, -1) {
+			target, ok := internalTarget(m[1])
+			if ok && !outputExists(target) {
+				broken = append(broken, fmt.Sprintf("%v: Broken link %v", post.Name, m[1]))
+			}
+		}
+	}
+	sort.Strings(broken)
+	return broken
+}
+
+// output path a root relative or BaseURL link points to, without query and
+// fragment. other links aren't internal.
+func internalTarget(link string) (string, bool) {
+	if config.BaseURL != "" && strings.HasPrefix(link, config.BaseURL+"/") {
+		link = link[len(config.BaseURL):]
+	}
+	if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") {
+		return "", false
+	}
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		link = link[:i]
+	}
+
+	if strings.HasSuffix(link, "/") {
+		link += "index.html"
+	}
+	return strings.TrimPrefix(path.Clean(link), "/"), true
+}
+
+// report whether the build produced output path p, also trying p.html and
+// p/index.html for links without an extension
+func outputExists(p string) bool {
+	// fingerprinted assets are linked by their original names
+	if hashed, ok := assetManifest[p]; ok {
+		p = hashed
+	}
+	candidates := []string{p}
+	if path.Ext(p) == "" {
+		candidates = append(candidates, p+".html", path.Join(p, "index.html"))
+	}
+	for _, c := range candidates {
+		file := filepath.Join(config.OutputDir, filepath.FromSlash(c))
+		outputs.Lock()
+		written := outputs.paths[file]
+		outputs.Unlock()
+		if written {
+			return true
+		}
+	}
+	return false
+}
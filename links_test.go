@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keidaa/llog"
+)
+
+const linkingSource = "# Linking\n\n[other](/other.html) [pretty](/other) [home](/) [css](/css/site.css?v=2) " +
+	"[base](http://example.com/other.html#top) [external](http://example.org/missing) [frag](#top) [rel](relative.html)\n"
+
+func TestInternalTarget(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+	for link, want := range map[string]string{
+		"/a.html":                    "a.html",
+		"/":                          "index.html",
+		"/tags/go/":                  "tags/go/index.html",
+		"/a.html?x=1#y":              "a.html",
+		"/a/../b.html":               "b.html",
+		"http://example.com/a.html":  "a.html",
+		"http://example.org/a.html":  "",
+		"//cdn.example.org/a.js":     "",
+		"#top":                       "",
+		"relative.html":              "",
+		"mailto:someone@example.com": "",
+	} {
+		got, ok := internalTarget(link)
+		if got != want || ok != (want != "") {
+			t.Errorf("internalTarget(%q) = %q, %v, want %q", link, got, ok, want)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	testSite(t)
+	*checkLinks = true
+	writeFile(t, filepath.Join(config.StaticDir, "css", "site.css"), "body{}")
+	writeSource(t, "2020-01-01-other.md", "# Other\n")
+	writeSource(t, "2020-01-02-linking.md", linkingSource)
+	testBuild(t)
+
+	// a missing target fails the build, naming the post
+	writeSource(t, "2020-01-03-typo.md", "# Typo\n\n[missing](/missing.html) and [again](http://example.com/gone/)\n")
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.ERROR)
+	err := build(true)
+	if err == nil || err.Error() != "2 broken internal links" {
+		t.Errorf("error = %v, want 2 broken links", err)
+	}
+	for _, want := range []string{"2020-01-03-typo: Broken link /missing.html", "2020-01-03-typo: Broken link http://example.com/gone/"} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, logged.String())
+		}
+	}
+	if strings.Contains(logged.String(), "linking") {
+		t.Errorf("working links reported:\n%s", logged.String())
+	}
+}
+
+func TestCheckLinksOff(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-typo.md", "# Typo\n\n[missing](/missing.html)\n")
+	testBuild(t)
+
+	config.StrictLinks = true
+	if err := build(true); err == nil {
+		t.Error("no error for a broken link with StrictLinks")
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/russross/blackfriday"
+)
+
+// names usable in MarkdownExtensions, mapped to blackfriday parser extensions
+var markdownExtensions = map[string]int{
+	"no-intra-emphasis":          blackfriday.EXTENSION_NO_INTRA_EMPHASIS,
+	"tables":                     blackfriday.EXTENSION_TABLES,
+	"fenced-code":                blackfriday.EXTENSION_FENCED_CODE,
+	"autolink":                   blackfriday.EXTENSION_AUTOLINK,
+	"strikethrough":              blackfriday.EXTENSION_STRIKETHROUGH,
+	"lax-html-blocks":            blackfriday.EXTENSION_LAX_HTML_BLOCKS,
+	"space-headers":              blackfriday.EXTENSION_SPACE_HEADERS,
+	"hard-line-break":            blackfriday.EXTENSION_HARD_LINE_BREAK,
+	"tab-size-eight":             blackfriday.EXTENSION_TAB_SIZE_EIGHT,
+	"footnotes":                  blackfriday.EXTENSION_FOOTNOTES,
+	"no-empty-line-before-block": blackfriday.EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK,
+	"header-ids":                 blackfriday.EXTENSION_HEADER_IDS,
+	"titleblock":                 blackfriday.EXTENSION_TITLEBLOCK,
+	"auto-header-ids":            blackfriday.EXTENSION_AUTO_HEADER_IDS,
+	"backslash-line-break":       blackfriday.EXTENSION_BACKSLASH_LINE_BREAK,
+	"definition-lists":           blackfriday.EXTENSION_DEFINITION_LISTS,
+	"join-lines":                 blackfriday.EXTENSION_JOIN_LINES,
+}
+
+// names usable in MarkdownExtensions, mapped to blackfriday html renderer flags
+var markdownHTMLFlags = map[string]int{
+	"skip-html":                 blackfriday.HTML_SKIP_HTML,
+	"skip-style":                blackfriday.HTML_SKIP_STYLE,
+	"skip-images":               blackfriday.HTML_SKIP_IMAGES,
+	"skip-links":                blackfriday.HTML_SKIP_LINKS,
+	"safelink":                  blackfriday.HTML_SAFELINK,
+	"nofollow-links":            blackfriday.HTML_NOFOLLOW_LINKS,
+	"noreferrer-links":          blackfriday.HTML_NOREFERRER_LINKS,
+	"noopener-links":            blackfriday.HTML_NOOPENER_LINKS,
+	"href-target-blank":         blackfriday.HTML_HREF_TARGET_BLANK,
+	"xhtml":                     blackfriday.HTML_USE_XHTML,
+	"smartypants":               blackfriday.HTML_USE_SMARTYPANTS,
+	"smartypants-fractions":     blackfriday.HTML_SMARTYPANTS_FRACTIONS,
+	"smartypants-dashes":        blackfriday.HTML_SMARTYPANTS_DASHES,
+	"smartypants-latex-dashes":  blackfriday.HTML_SMARTYPANTS_LATEX_DASHES,
+	"smartypants-angled-quotes": blackfriday.HTML_SMARTYPANTS_ANGLED_QUOTES,
+	"footnote-return-links":     blackfriday.HTML_FOOTNOTE_RETURN_LINKS,
+}
+
+// the options blackfriday.MarkdownCommon uses, except autolink which is up
+// to Autolink
+var defaultMarkdownExtensions = []string{
+	"no-intra-emphasis",
+	"tables",
+	"fenced-code",
+	"strikethrough",
+	"space-headers",
+	"header-ids",
+	"backslash-line-break",
+	"definition-lists",
+	"xhtml",
+	"smartypants",
+	"smartypants-fractions",
+	"smartypants-dashes",
+	"smartypants-latex-dashes",
+}
+
+// combine names into blackfriday extensions and html flags
+func markdownOptions(names []string) (extensions, htmlFlags int, err error) {
+	for _, name := range names {
+		if ext, ok := markdownExtensions[name]; ok {
+			extensions |= ext
+		} else if flag, ok := markdownHTMLFlags[name]; ok {
+			htmlFlags |= flag
+		} else {
+			return 0, 0, fmt.Errorf("Unknown markdown extension: %v", name)
+		}
+	}
+	return extensions, htmlFlags, nil
+}
+
+// a heading in a post's table of contents
+type TOCEntry struct {
+	ID,
+	Text string
+	Level    int
+	Children []*TOCEntry
+}
+
+// convert markdown to html using the configured MarkdownExtensions, returning
+// the table of contents built from its h2 to h4 headings
+func renderMarkdown(input []byte) ([]byte, []*TOCEntry) {
+	// names are checked by readConfig
+	extensions, htmlFlags, _ := markdownOptions(config.MarkdownExtensions)
+	if config.Footnotes {
+		extensions |= blackfriday.EXTENSION_FOOTNOTES | blackfriday.EXTENSION_DEFINITION_LISTS
+		htmlFlags |= blackfriday.HTML_FOOTNOTE_RETURN_LINKS
+	}
+	if config.Autolink {
+		extensions |= blackfriday.EXTENSION_AUTOLINK
+	}
+
+	var math [][]byte
+	if config.Math {
+		input, math = protectMath(input)
+	}
+	renderer := &htmlRenderer{
+		Renderer:     blackfriday.HtmlRenderer(htmlFlags, "", ""),
+		anchors:      make(map[string]bool),
+		math:         math,
+		footnotes:    make(map[string]int),
+		footnoteRefs: make(map[int]int),
+	}
+	output := blackfriday.MarkdownOptions(input, renderer, blackfriday.Options{Extensions: extensions})
+	if math != nil {
+		output = restoreMath(output, math)
+	}
+	return output, nestTOC(renderer.headings)
+}
+
+// code, an escaped dollar, display math or inline math. inline math can't
+// start or end with a space, so prices like $5 and $10 stay text, and can't
+// hold a backtick, so a price before a code span doesn't swallow its start.
+var mathPattern = regexp.MustCompile("(?s)```.*?```|~~~.*?~~~|`[^`]*`|" + `\\\$|\$\$.+?\$\$|\$[^\s$` + "`" + `](?:[^$\n` + "`" + `]*[^\s$` + "`" + `])?\$`)
+
+// placeholders markdown leaves alone, standing in for math spans
+var mathPlaceholder = regexp.MustCompile(`instigatormath(\d+)x`)
+
+// replace math spans outside code in input with placeholders, returning the
+// spans in placeholder order
+func protectMath(input []byte) ([]byte, [][]byte) {
+	var spans [][]byte
+	output := mathPattern.ReplaceAllFunc(input, func(m []byte) []byte {
+		if m[0] != '$' {
+			return m
+		}
+		spans = append(spans, append([]byte(nil), m...))
+		return []byte(fmt.Sprintf("instigatormath%dx", len(spans)-1))
+	})
+	return output, spans
+}
+
+// put the html escaped math spans back in place of their placeholders
+func restoreMath(output []byte, spans [][]byte) []byte {
+	return mathPlaceholder.ReplaceAllFunc(output, func(m []byte) []byte {
+		var n int
+		fmt.Sscanf(string(m), "instigatormath%dx", &n)
+		if n >= len(spans) {
+			return m
+		}
+		return []byte(html.EscapeString(string(spans[n])))
+	})
+}
+
+// blackfriday's html renderer, adding heading anchors and code highlighting.
+// a new one is needed for every document.
+type htmlRenderer struct {
+	blackfriday.Renderer
+	anchors  map[string]bool
+	headings []*TOCEntry
+	math     [][]byte // spans protected from markdown, see protectMath
+
+	footnotes    map[string]int // footnote names to their numbers
+	footnoteRefs map[int]int    // references to each footnote so far
+}
+
+// number footnote ids rather than slugifying their names, which can collide,
+// and give every reference after the first its own id
+func (r *htmlRenderer) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
+	r.footnotes[string(ref)] = id
+	r.footnoteRefs[id]++
+	refID := fmt.Sprintf("fnref:%d", id)
+	if n := r.footnoteRefs[id]; n > 1 {
+		refID = fmt.Sprintf("%v-%d", refID, n)
+	}
+	fmt.Fprintf(out, `<sup class="footnote-ref" id="%s"><a href="#fn:%d">%d</a></sup>`, refID, id, id)
+}
+
+// footnote with the numbered id its references link to, the return link
+// going back to the first
+func (r *htmlRenderer) FootnoteItem(out *bytes.Buffer, name, text []byte, flags int) {
+	r.Renderer.FootnoteItem(out, []byte(strconv.Itoa(r.footnotes[string(name)])), text, flags)
+}
+
+// render headings with an id unique within the document, derived from the
+// heading text unless given explicitly
+func (r *htmlRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	marker := out.Len()
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+	inner := string(out.Bytes()[marker:])
+	out.Truncate(marker)
+
+	// math back in place first, so the anchor and toc use the real text
+	if r.math != nil {
+		inner = string(restoreMath([]byte(inner), r.math))
+	}
+
+	if id == "" {
+		id = slugify(plainText(inner))
+	}
+	if id == "" {
+		id = "section"
+	}
+	anchor := id
+	for i := 1; r.anchors[anchor]; i++ {
+		anchor = fmt.Sprintf("%v-%d", id, i)
+	}
+	r.anchors[anchor] = true
+
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	fmt.Fprintf(out, "<h%d id=\"%s\">%s</h%d>\n", level, anchor, inner, level)
+
+	if level >= 2 && level <= 4 {
+		r.headings = append(r.headings, &TOCEntry{ID: anchor, Text: plainText(inner), Level: level})
+	}
+}
+
+// nest headings below the closest preceding heading of a higher level
+func nestTOC(headings []*TOCEntry) []*TOCEntry {
+	var toc, parents []*TOCEntry
+	for _, h := range headings {
+		for len(parents) > 0 && parents[len(parents)-1].Level >= h.Level {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) == 0 {
+			toc = append(toc, h)
+		} else {
+			parent := parents[len(parents)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		parents = append(parents, h)
+	}
+	return toc
+}
+
+// highlight fenced code blocks that name a known language when HighlightStyle is set
+func (r *htmlRenderer) BlockCode(out *bytes.Buffer, text []byte, infoString string) {
+	if config.HighlightStyle == "" {
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+
+	lang := ""
+	if fields := strings.Fields(infoString); len(fields) > 0 {
+		lang = fields[0]
+	}
+
+	// unknown or missing languages are rendered as plain code
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(text))
+	if err != nil {
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+
+	// highlighted block replaces the plain one only if formatting succeeds
+	var buf bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithClasses(config.HighlightClasses))
+	if err := formatter.Format(&buf, styles.Get(config.HighlightStyle), iterator); err != nil {
+		r.Renderer.BlockCode(out, text, infoString)
+		return
+	}
+	out.Write(buf.Bytes())
+}
+
+// bare email address in body text
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// turn bare email addresses into mailto links when Autolink is set
+func (r *htmlRenderer) NormalText(out *bytes.Buffer, text []byte) {
+	if !config.Autolink {
+		r.Renderer.NormalText(out, text)
+		return
+	}
+
+	last := 0
+	for _, m := range emailPattern.FindAllIndex(text, -1) {
+		r.Renderer.NormalText(out, text[last:m[0]])
+		fmt.Fprintf(out, `<a href="mailto:%s">%s</a>`, text[m[0]:m[1]], text[m[0]:m[1]])
+		last = m[1]
+	}
+	r.Renderer.NormalText(out, text[last:])
+}
+
+// mailto link NormalText made of an email address
+var mailtoPattern = regexp.MustCompile(`<a href="mailto:[^"]*">([^<]*)</a>`)
+
+// link text has been through NormalText already, so an email address in it
+// is unlinked again rather than nesting links
+func (r *htmlRenderer) Link(out *bytes.Buffer, link, title, content []byte) {
+	if config.Autolink {
+		content = mailtoPattern.ReplaceAll(content, []byte("$1"))
+	}
+	r.Renderer.Link(out, link, title, content)
+}
+
+// write the stylesheet for class based highlighting to OutputDir/highlight.css
+func writeHighlightCSS() error {
+	var buf bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	if err := formatter.WriteCSS(&buf, styles.Get(config.HighlightStyle)); err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, "highlight.css"), buf.Bytes())
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const footnoteSource = "Text with a note[^1].\n\n[^1]: The note.\n"
+
+func TestMarkdownFootnotes(t *testing.T) {
+	testConfig(t)
+
+	out, _ := renderMarkdown([]byte(footnoteSource))
+	if strings.Contains(string(out), `class="footnotes"`) || !strings.Contains(string(out), "[^1]") {
+		t.Errorf("footnotes rendered without the extension:\n%s", out)
+	}
+
+	config.MarkdownExtensions = append(config.MarkdownExtensions, "footnotes")
+	out, _ = renderMarkdown([]byte(footnoteSource))
+	if !strings.Contains(string(out), `class="footnotes"`) || !strings.Contains(string(out), "The note.") || strings.Contains(string(out), "[^1]") {
+		t.Errorf("footnotes not rendered with the extension:\n%s", out)
+	}
+}
+
+func TestMarkdownExtensions(t *testing.T) {
+	testConfig(t)
+
+	config.MarkdownExtensions = nil
+	out, _ := renderMarkdown([]byte("one\ntwo\n"))
+	if strings.Contains(string(out), "<br") {
+		t.Errorf("line break without hard-line-break:\n%s", out)
+	}
+	config.MarkdownExtensions = []string{"hard-line-break"}
+	out, _ = renderMarkdown([]byte("one\ntwo\n"))
+	if !strings.Contains(string(out), "one<br>") {
+		t.Errorf("no line break with hard-line-break:\n%s", out)
+	}
+
+	config.MarkdownExtensions = []string{"definition-lists"}
+	out, _ = renderMarkdown([]byte("Term\n: Definition\n"))
+	if !strings.Contains(string(out), "<dt>Term</dt>") {
+		t.Errorf("no definition list with definition-lists:\n%s", out)
+	}
+}
+
+func TestMarkdownExtensionsUnknown(t *testing.T) {
+	err := loadConfig(t, "config.json", `{"MarkdownExtensions": ["tables", "sparkles"]}`)
+	if err == nil || !strings.Contains(err.Error(), "sparkles") {
+		t.Errorf("error = %v, want one naming the unknown extension", err)
+	}
+}
+
+const goSource = "```go\nfunc main() {}\n```\n"
+
+func TestHighlight(t *testing.T) {
+	testConfig(t)
+
+	out, _ := renderMarkdown([]byte(goSource))
+	if strings.Contains(string(out), "<span") {
+		t.Errorf("highlighted without HighlightStyle:\n%s", out)
+	}
+
+	config.HighlightStyle = "monokai"
+	out, _ = renderMarkdown([]byte(goSource))
+	if !strings.Contains(string(out), `<span style="`) || !strings.Contains(string(out), ">func</span>") {
+		t.Errorf("go block not highlighted inline:\n%s", out)
+	}
+
+	config.HighlightClasses = true
+	out, _ = renderMarkdown([]byte(goSource))
+	if !strings.Contains(string(out), `<span class="`) || strings.Contains(string(out), "style=") {
+		t.Errorf("go block not highlighted with classes:\n%s", out)
+	}
+}
+
+func TestHighlightUnknownLanguage(t *testing.T) {
+	testConfig(t)
+	config.HighlightStyle = "monokai"
+
+	for _, src := range []string{"```nosuchlang\na < b\n```\n", "```\na < b\n```\n"} {
+		out, _ := renderMarkdown([]byte(src))
+		if strings.Contains(string(out), "<span") || !strings.Contains(string(out), "<pre><code") || !strings.Contains(string(out), "a &lt; b") {
+			t.Errorf("%q not rendered as plain code:\n%s", src, out)
+		}
+	}
+}
+
+func TestHighlightCSS(t *testing.T) {
+	testSite(t)
+	config.HighlightStyle = "monokai"
+	config.HighlightClasses = true
+	writeSource(t, "2020-01-01-code.md", "# Code\n\n"+goSource)
+	testBuild(t)
+
+	if css := readOutput(t, "highlight.css"); !strings.Contains(css, ".chroma") {
+		t.Errorf("highlight.css = %q", css)
+	}
+}
+
+func TestTOC(t *testing.T) {
+	testConfig(t)
+	out, toc := renderMarkdown([]byte("# Title\n\n## Intro\n\n### Detail\n\n#### Deeper\n\n##### Too deep\n\n### Detail\n\n## Intro\n\n## Fish & Chips\n"))
+
+	// h1 and h5 stay out, the rest nest by level
+	var flat []string
+	var walk func(entries []*TOCEntry, depth int)
+	walk = func(entries []*TOCEntry, depth int) {
+		for _, e := range entries {
+			flat = append(flat, strings.Repeat(">", depth)+e.ID+"="+e.Text)
+			walk(e.Children, depth+1)
+		}
+	}
+	walk(toc, 0)
+	want := "intro=Intro,>detail=Detail,>>deeper=Deeper,>detail-1=Detail,intro-1=Intro,fish-chips=Fish & Chips"
+	if got := strings.Join(flat, ","); got != want {
+		t.Errorf("toc = %v, want %v", got, want)
+	}
+
+	// anchors in the page match the toc
+	for _, id := range []string{"title", "intro", "intro-1", "detail", "detail-1", "deeper", "too-deep", "fish-chips"} {
+		if !strings.Contains(string(out), `id="`+id+`"`) {
+			t.Errorf("no heading with id %v in:\n%s", id, out)
+		}
+	}
+}
+
+func TestTOCExplicitIDs(t *testing.T) {
+	testConfig(t)
+	_, toc := renderMarkdown([]byte("## One {#custom}\n\n## Two {#custom}\n\n## !!!\n"))
+	if len(toc) != 3 || toc[0].ID != "custom" || toc[1].ID != "custom-1" || toc[2].ID != "section" {
+		t.Errorf("toc = %+v", toc)
+	}
+}
+
+func TestTOCInPostPage(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-long.md", "# Long\n\n## Fish & Chips\n\n### Vinegar\n\ntext\n")
+	testBuild(t)
+
+	page := readOutput(t, "long.html")
+	for _, want := range []string{`<nav class="toc">`, `<a href="#fish-chips">Fish &amp; Chips</a>`, `<a href="#vinegar">Vinegar</a>`, `<h2 id="fish-chips">`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("post page lacks %v:\n%s", want, page)
+		}
+	}
+}
+
+const footnotesSource = "One[^note 1], two[^note-1] and one again[^note 1].\n\n" +
+	"[^note 1]: First.\n[^note-1]: Second.\n\nTerm\n: Definition\n"
+
+func TestFootnotes(t *testing.T) {
+	testConfig(t)
+	config.MarkdownExtensions = nil
+
+	out, _ := renderMarkdown([]byte(footnotesSource))
+	if strings.Contains(string(out), `class="footnotes"`) || strings.Contains(string(out), "<dl>") {
+		t.Errorf("footnotes or definition list without Footnotes:\n%s", out)
+	}
+
+	config.Footnotes = true
+	out, _ = renderMarkdown([]byte(footnotesSource))
+	for _, want := range []string{
+		`<sup class="footnote-ref" id="fnref:1"><a href="#fn:1">1</a></sup>`,
+		`<sup class="footnote-ref" id="fnref:2"><a href="#fn:2">2</a></sup>`,
+		`<sup class="footnote-ref" id="fnref:1-2"><a href="#fn:1">1</a></sup>`,
+		`<li id="fn:1">First.`,
+		`<li id="fn:2">Second.`,
+		`<a class="footnote-return" href="#fnref:1">`,
+		`<a class="footnote-return" href="#fnref:2">`,
+		"<dt>Term</dt>\n<dd>Definition</dd>",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("footnotes lack %v:\n%s", want, out)
+		}
+	}
+
+	// names slugifying alike still get their own ids
+	ids := make(map[string]bool)
+	for _, m := range regexp.MustCompile(`id="([^"]*)"`).FindAllStringSubmatch(string(out), -1) {
+		if ids[m[1]] {
+			t.Errorf("id %v used twice:\n%s", m[1], out)
+		}
+		ids[m[1]] = true
+	}
+
+	// the same in every render
+	again, _ := renderMarkdown([]byte(footnotesSource))
+	if string(again) != string(out) {
+		t.Errorf("footnotes rendered differently the second time:\n%s", again)
+	}
+}
+
+const autolinkSource = "Visit https://example.org/page or write to me@example.org.\n\n" +
+	"[me@example.org](mailto:me@example.org) and `code@example.org`\n"
+
+func TestAutolink(t *testing.T) {
+	testConfig(t)
+
+	out, _ := renderMarkdown([]byte(autolinkSource))
+	if strings.Contains(string(out), `href="https://example.org/page"`) || strings.Contains(string(out), `<a href="mailto:me@example.org">me@example.org</a>.`) {
+		t.Errorf("bare url or email linked without Autolink:\n%s", out)
+	}
+
+	config.Autolink = true
+	out, _ = renderMarkdown([]byte(autolinkSource))
+	for _, want := range []string{
+		`<a href="https://example.org/page">https://example.org/page</a>`,
+		`write to <a href="mailto:me@example.org">me@example.org</a>.`,
+		`<p><a href="mailto:me@example.org">me@example.org</a> and <code>code@example.org</code></p>`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("autolinked output lacks %v:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "<a href=\"mailto:me@example.org\"><a") {
+		t.Errorf("link nested in an email link:\n%s", out)
+	}
+}
+
+const mathSource = "Inline $x = *a* + b_1$ and display\n\n$$\n\\sum_{i=1}^n x_i * y_i\n$$\n\n" +
+	"Prices $5 and $10 stay text, `$y_1 * y_2$` is code.\n\n## Energy $E=mc^2$ here\n\n```\n$z_1 * z_2$\n```\n\n$a<b$\n"
+
+func TestMath(t *testing.T) {
+	testConfig(t)
+
+	out, _ := renderMarkdown([]byte(mathSource))
+	if !strings.Contains(string(out), "<em>") {
+		t.Errorf("math spans protected without Math:\n%s", out)
+	}
+
+	config.Math = true
+	out, toc := renderMarkdown([]byte(mathSource))
+	for _, want := range []string{
+		"Inline $x = *a* + b_1$ and display",
+		"$$\n\\sum_{i=1}^n x_i * y_i\n$$",
+		"Prices $5 and $10 stay text",
+		"<code>$y_1 * y_2$</code>",
+		`<h2 id="energy-e-mc-2-here">Energy $E=mc^2$ here</h2>`,
+		"<pre><code>$z_1 * z_2$\n</code></pre>",
+		"<p>$a&lt;b$</p>",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("math output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "<em>") || strings.Contains(string(out), "instigatormath") {
+		t.Errorf("math mangled or left as a placeholder:\n%s", out)
+	}
+	if len(toc) != 1 || toc[0].ID != "energy-e-mc-2-here" || toc[0].Text != "Energy $E=mc^2$ here" {
+		t.Errorf("toc = %+v", toc)
+	}
+}
+
+func TestMathPlaceholderText(t *testing.T) {
+	testConfig(t)
+	config.Math = true
+
+	// text looking like a placeholder comes out as written
+	out, _ := renderMarkdown([]byte("instigatormath7x and $x$\n"))
+	if !strings.Contains(string(out), "<p>instigatormath7x and $x$</p>") {
+		t.Errorf("placeholder lookalike changed:\n%s", out)
+	}
+}
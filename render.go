@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// converts the body of a source file to html
+type sourceRenderer interface {
+	// html and table of contents of input
+	render(input []byte) ([]byte, []*TOCEntry, error)
+	// text of the first headline in lines, empty when there is none
+	title(lines []string) string
+}
+
+// extensions of asciidoc sources
+var asciidocExts = map[string]bool{
+	".adoc":     true,
+	".asciidoc": true,
+}
+
+// renderer for the source file name by its extension, nil for files that
+// aren't sources. SourceExtensions are markdown.
+func rendererFor(name string) sourceRenderer {
+	if sourceExt(name) != "" {
+		return markdownRenderer{}
+	}
+	if asciidocExts[strings.ToLower(filepath.Ext(name))] {
+		return asciidocRenderer{}
+	}
+	return nil
+}
+
+type markdownRenderer struct{}
+
+func (markdownRenderer) render(input []byte) ([]byte, []*TOCEntry, error) {
+	output, toc := renderMarkdown(input)
+	return output, toc, nil
+}
+
+func (markdownRenderer) title(lines []string) string {
+	return findTitle(lines)
+}
+
+// asciidoc through the asciidoctor command, which has to be installed
+type asciidocRenderer struct{}
+
+func (asciidocRenderer) render(input []byte) ([]byte, []*TOCEntry, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("asciidoctor", "--no-header-footer", "--safe-mode", "safe", "--out-file", "-", "-")
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to run asciidoctor: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil, nil
+}
+
+// the document title, a line starting with a single =
+func (asciidocRenderer) title(lines []string) string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "= ") {
+			return strings.TrimSpace(line[2:])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keidaa/llog"
+)
+
+// put a stand in for asciidoctor first on PATH, wrapping the lines after the
+// document title in a paragraph
+func fakeAsciidoctor(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '<div class=\"paragraph\">'\necho \"<p>$(grep -v '^= ')</p>\"\necho '</div>'\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "asciidoctor"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRendererFor(t *testing.T) {
+	testConfig(t)
+	for name, want := range map[string]sourceRenderer{
+		"post.md":        markdownRenderer{},
+		"post.adoc":      asciidocRenderer{},
+		"post.ASCIIDOC":  asciidocRenderer{},
+		"post.rst":       nil,
+		"post.adoc.html": nil,
+	} {
+		if got := rendererFor(name); got != want {
+			t.Errorf("rendererFor(%v) = %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestAsciidoc(t *testing.T) {
+	testSite(t)
+	fakeAsciidoctor(t)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `<h1>{{ .Title }}</h1>{{ .Content }}`)
+	writeSource(t, "2020-01-01-legacy.adoc", "= Legacy Post\n\nOld content.\n")
+	testBuild(t)
+
+	got := readOutput(t, "legacy-post.html")
+	if !strings.Contains(got, "<h1>Legacy Post</h1>") || !strings.Contains(got, `<div class="paragraph">`) || !strings.Contains(got, "Old content.") {
+		t.Errorf("asciidoc post =\n%v", got)
+	}
+}
+
+func TestAsciidocMissing(t *testing.T) {
+	testConfig(t)
+	t.Setenv("PATH", t.TempDir())
+	if _, _, err := (asciidocRenderer{}).render([]byte("= Title\n")); err == nil || !strings.Contains(err.Error(), "asciidoctor") {
+		t.Errorf("error = %v, want one naming asciidoctor", err)
+	}
+}
+
+func TestUnknownSourceSkipped(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	writeSource(t, "2020-01-02-legacy.rst", "Legacy\n======\n")
+	writeSource(t, "2020-01-03-other.rst", "Other\n=====\n")
+
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.WARNING)
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srcFiles) != 1 || filepath.Base(srcFiles[0]) != "2020-01-01-post.md" {
+		t.Errorf("sources = %v, want the markdown post only", srcFiles)
+	}
+	if n := strings.Count(logged.String(), "Skipping .rst files"); n != 1 {
+		t.Errorf("warned %d times about .rst files, want once:\n%s", n, logged.String())
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type searchEntry struct {
+	Title string    `json:"title"`
+	URL   string    `json:"url"`
+	Date  time.Time `json:"date"`
+	Tags  []string  `json:"tags"`
+	Body  string    `json:"body,omitempty"`
+}
+
+// write search.json for client side search, with plain text post bodies
+// when SearchIndexBody is set
+func writeSearchIndex(posts Posts) error {
+	// sort posts
+	sort.Sort(posts)
+
+	entries := make([]searchEntry, 0, len(posts))
+	for _, post := range posts {
+		entry := searchEntry{
+			Title: post.Title,
+			URL:   post.URL(),
+			Date:  post.Date,
+			Tags:  post.Tags,
+		}
+		if entry.Tags == nil {
+			entry.Tags = []string{}
+		}
+		if config.SearchIndexBody {
+			entry.Body = plainText(post.Content)
+		}
+		entries = append(entries, entry)
+	}
+
+	out, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, "search.json"), out)
+}
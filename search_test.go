@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// decode search.json into generic values, to check the field names too
+func readSearchIndex(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	if err := json.Unmarshal([]byte(readOutput(t, "search.json")), &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestSearchIndex(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-first.md", "---\ntitle: First\ntags: [go, web]\n---\nSome *body* text.\n")
+	writeSource(t, "2020-01-02-second.md", "# Second\n\nMore.\n")
+	writeSource(t, "2020-01-03-draft.md", "---\ntitle: Draft\ndraft: true\n---\nsecret\n")
+	testBuild(t)
+
+	entries := readSearchIndex(t)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2 without the draft: %v", len(entries), entries)
+	}
+	first := entries[1]
+	if first["title"] != "First" || first["url"] != "http://example.com/first.html" {
+		t.Errorf("entry = %v", first)
+	}
+	if date, err := time.Parse(time.RFC3339, first["date"].(string)); err != nil || date.Format("2006-01-02") != "2020-01-01" {
+		t.Errorf("date = %v", first["date"])
+	}
+	if tags, ok := first["tags"].([]interface{}); !ok || len(tags) != 2 || tags[0] != "go" {
+		t.Errorf("tags = %v", first["tags"])
+	}
+	if tags, ok := entries[0]["tags"].([]interface{}); !ok || len(tags) != 0 {
+		t.Errorf("tags of an untagged post = %v, want an empty list", entries[0]["tags"])
+	}
+	if _, ok := first["body"]; ok {
+		t.Errorf("body included without SearchIndexBody: %v", first)
+	}
+
+	config.SearchIndexBody = true
+	testBuild(t)
+	if body := readSearchIndex(t)[1]["body"]; body != "Some body text." {
+		t.Errorf("body = %q, want the plain text", body)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// event stream telling served pages to reload after a rebuild
+const reloadPath = "/_reload"
+
+// injected into every served html page
+const reloadScript = `<script>
+(function() {
+	var events = new EventSource("` + reloadPath + `");
+	events.onmessage = function() { location.reload(); };
+})();
+</script>
+`
+
+// server-sent events endpoint notifying connected pages about rebuilds
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan bool]bool
+}
+
+func newReloader() *reloader {
+	return &reloader{clients: make(map[chan bool]bool)}
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	client := make(chan bool, 1)
+	rl.mu.Lock()
+	rl.clients[client] = true
+	rl.mu.Unlock()
+
+	defer func() {
+		rl.mu.Lock()
+		delete(rl.clients, client)
+		rl.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-client:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// tell every connected page to reload
+func (rl *reloader) notify() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for client := range rl.clients {
+		// a reload already pending is as good as a new one
+		select {
+		case client <- true:
+		default:
+		}
+	}
+}
+
+// serve html files from OutputDir with the reload script added, everything
+// else is left to next
+func injectReload(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			p = path.Join(p, "index.html")
+		}
+		if path.Ext(p) != ".html" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(config.OutputDir, filepath.FromSlash(p)))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(addReloadScript(data))
+	})
+}
+
+// place the reload script at the end of the body, or the end of the page if
+// there is none
+func addReloadScript(data []byte) []byte {
+	if i := bytes.LastIndex(bytes.ToLower(data), []byte("</body>")); i >= 0 {
+		return append(data[:i:i], append([]byte(reloadScript), data[i:]...)...)
+	}
+	return append(data, reloadScript...)
+}
+
+// where drafts are served with -servedrafts
+const draftsPath = "/drafts/"
+
+// render drafts from the current sources on every request, so they're seen
+// in the browser but never end up in OutputDir. draftsPath itself lists them.
+func serveDraft(w http.ResponseWriter, r *http.Request) {
+	srcFiles, err := listSrcFiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	posts, errs := parsePosts(srcFiles)
+	for _, err := range errs {
+		log.Debug(err)
+	}
+
+	var drafts Posts
+	for _, post := range posts {
+		if post.Draft {
+			drafts = append(drafts, post)
+		}
+	}
+	sort.Sort(drafts)
+
+	p := strings.TrimPrefix(path.Clean(r.URL.Path), strings.TrimSuffix(draftsPath, "/"))
+	var out []byte
+	if p == "" || p == "/" {
+		out, err = renderDraftList(drafts)
+	} else {
+		err = os.ErrNotExist
+		for i := range drafts {
+			if p == "/"+drafts[i].Path() || p == pageURLPath(drafts[i].Path()) {
+				out, err = renderPost(&drafts[i])
+				break
+			}
+		}
+	}
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(addReloadScript(out))
+}
+
+// root relative url path of the page at output path p, as requested from the
+// server. directory index files are requested by their directory.
+func pageURLPath(p string) string {
+	if path.Base(p) == "index.html" {
+		return path.Dir("/" + p)
+	}
+	return "/" + p
+}
+
+// page linking to every draft below draftsPath
+func renderDraftList(drafts Posts) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("<h3>Drafts:</h3>\n<ul>\n")
+	for _, post := range drafts {
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n",
+			html.EscapeString(path.Join(draftsPath, post.Path())), html.EscapeString(post.Title))
+	}
+	b.WriteString("</ul>\n")
+
+	page := Page{
+		"Drafts",
+		b.String(),
+	}
+	return renderTemplate(filepath.Join(config.TemplateDir, "main.html"), page)
+}
+
+// serve OutputDir on Host and Port in the background, until the returned
+// listener is closed
+func startServer(rl *reloader) (net.Listener, error) {
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, rl)
+	mux.Handle("/", injectReload(http.FileServer(http.Dir(config.OutputDir))))
+	if *serveDrafts {
+		mux.HandleFunc(draftsPath, serveDraft)
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(config.Host, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, err
+	}
+	// the address listened on, with the port picked when Port is 0
+	log.Infof("Serving %v at http://%v/", config.OutputDir, ln.Addr())
+
+	go func() {
+		if err := http.Serve(ln, mux); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Error(err)
+		}
+	}()
+	return ln, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keidaa/llog"
+)
+
+// start the server on a free port, returning its root url
+func testServer(t *testing.T, rl *reloader) string {
+	t.Helper()
+	config.Port = 0
+	var logged bytes.Buffer
+	log = llog.New(&logged, llog.INFO)
+	ln, err := startServer(rl)
+	log = llog.New(ioutil.Discard, llog.ERROR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	url := "http://" + ln.Addr().String() + "/"
+	if !strings.Contains(logged.String(), url) {
+		t.Errorf("log = %q, want the url %v", logged.String(), url)
+	}
+	return url
+}
+
+func get(t *testing.T, url string) (string, *http.Response) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp
+}
+
+func TestServeReloadScript(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.OutputDir, "index.html"), "<html><body><p>index</p></body></html>")
+	writeFile(t, filepath.Join(config.OutputDir, "style.css"), "body{}")
+	url := testServer(t, newReloader())
+
+	for _, p := range []string{"index.html", ""} {
+		body, resp := get(t, url+p)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("/%v: status %v", p, resp.Status)
+		}
+		if !strings.Contains(body, reloadPath) || !strings.HasSuffix(body, reloadScript+"</body></html>") {
+			t.Errorf("/%v = %q, want the reload script before </body>", p, body)
+		}
+	}
+
+	// other files go out untouched
+	if body, _ := get(t, url+"style.css"); body != "body{}" {
+		t.Errorf("/style.css = %q", body)
+	}
+}
+
+func TestServeReloadEvents(t *testing.T) {
+	testSite(t)
+	rl := newReloader()
+	url := testServer(t, rl)
+
+	resp, err := http.Get(url + strings.TrimPrefix(reloadPath, "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// the client registers once the headers are out
+	for i := 0; ; i++ {
+		rl.mu.Lock()
+		n := len(rl.clients)
+		rl.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("client never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rl.notify()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "data: reload\n" {
+		t.Errorf("event = %q, want a reload", line)
+	}
+}
+
+func TestServeLocalhost(t *testing.T) {
+	testSite(t)
+	if config.Host != "localhost" {
+		t.Errorf("Host = %q, want localhost by default", config.Host)
+	}
+
+	url := testServer(t, newReloader())
+	host, _, err := net.SplitHostPort(strings.TrimSuffix(strings.TrimPrefix(url, "http://"), "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		t.Errorf("listening on %v, want a loopback address", host)
+	}
+}
+
+func TestAddReloadScript(t *testing.T) {
+	for in, want := range map[string]string{
+		"<body>x</body>":      "<body>x" + reloadScript + "</body>",
+		"<BODY>x</BODY>\n":    "<BODY>x" + reloadScript + "</BODY>\n",
+		"<p>no body</p>":      "<p>no body</p>" + reloadScript,
+		"</body>a</body>tail": "</body>a" + reloadScript + "</body>tail",
+	} {
+		if got := string(addReloadScript([]byte(in))); got != want {
+			t.Errorf("addReloadScript(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestServeDrafts(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-public.md", "# Public\n\nshown\n")
+	writeSource(t, "2020-01-02-secret.md", "---\ntitle: Secret\ndraft: true\n---\nunpublished words\n")
+	testBuild(t)
+
+	// drafts are only served with -servedrafts
+	url := testServer(t, newReloader())
+	if _, resp := get(t, url+"drafts/"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/drafts/ without -servedrafts: status %v", resp.Status)
+	}
+
+	*serveDrafts = true
+	url = testServer(t, newReloader())
+	body, resp := get(t, url+"drafts/")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `<a href="/drafts/secret.html">Secret</a>`) || strings.Contains(body, "Public") {
+		t.Errorf("/drafts/: status %v\n%s", resp.Status, body)
+	}
+	body, resp = get(t, url+"drafts/secret.html")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "unpublished words") || !strings.Contains(body, reloadScript) {
+		t.Errorf("/drafts/secret.html: status %v\n%s", resp.Status, body)
+	}
+	for _, p := range []string{"drafts/public.html", "drafts/missing.html"} {
+		if _, resp := get(t, url+p); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("/%v: status %v, want not found", p, resp.Status)
+		}
+	}
+
+	// nothing of the draft on disk
+	for _, p := range []string{"secret.html", "drafts/secret.html", "drafts"} {
+		if outputExistsAt(t, p) {
+			t.Errorf("%v written to OutputDir", p)
+		}
+	}
+	for _, p := range []string{"index.html", "rss.xml"} {
+		if strings.Contains(readOutput(t, p), "Secret") {
+			t.Errorf("draft listed in %v", p)
+		}
+	}
+}
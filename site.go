@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// site wide values available to every template as .Site
+type Site struct {
+	Title,
+	BaseURL string
+
+	// keys of DataFile, and the contents of each DataDir/<name>.json as name
+	Data map[string]interface{}
+}
+
+// loaded at the start of each build
+var site Site
+
+// read DataFile and DataDir, both of which are optional
+func loadSite() error {
+	data := make(map[string]interface{})
+
+	if file, err := ioutil.ReadFile(config.DataFile); err == nil {
+		if err := json.Unmarshal(file, &data); err != nil {
+			return fmt.Errorf("Unable to parse %v: %v", config.DataFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(config.DataDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		file, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if err := json.Unmarshal(file, &value); err != nil {
+			return fmt.Errorf("Unable to parse %v: %v", name, err)
+		}
+		data[strings.TrimSuffix(filepath.Base(name), ".json")] = value
+	}
+
+	site = Site{config.SiteTitle, config.BaseURL, data}
+	return nil
+}
+
+// a listing or other generated page tucked into main.html
+type Page struct {
+	Title,
+	Content string
+}
+
+// the site, for templates rendering any of these
+func (Page) Site() Site      { return site }
+func (Post) Site() Site      { return site }
+func (Posts) Site() Site     { return site }
+func (IndexData) Site() Site { return site }
+func (Archive) Site() Site   { return site }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSiteData(t *testing.T) {
+	testSite(t)
+	writeFile(t, config.DataFile, `{"nav": [{"title": "Home", "url": "/"}, {"title": "About", "url": "/about.html"}], "twitter": "@site"}`)
+	writeFile(t, filepath.Join(config.DataDir, "social.json"), `{"github": "site"}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"),
+		`{{ .Site.Title }}|{{ range .Site.Data.nav }}<a href="{{ .url }}">{{ .title }}</a>{{ end }}|{{ .Site.Data.twitter }}|{{ .Site.Data.social.github }}`)
+	writeFile(t, filepath.Join(config.TemplateDir, "post.html"), `{{ .Site.BaseURL }} {{ range .Site.Data.nav }}{{ .title }} {{ end }}`)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+
+	if got, want := readOutput(t, "index.html"), `My Site|<a href="/">Home</a><a href="/about.html">About</a>|@site|site`; got != want {
+		t.Errorf("index = %q, want %q", got, want)
+	}
+	if got, want := readOutput(t, "post.html"), "http://example.com Home About "; got != want {
+		t.Errorf("post page = %q, want %q", got, want)
+	}
+}
+
+func TestSiteDataMissing(t *testing.T) {
+	testSite(t)
+	if err := loadSite(); err != nil {
+		t.Fatal(err)
+	}
+	if len(site.Data) != 0 || site.Title != config.SiteTitle {
+		t.Errorf("site = %+v, want no data", site)
+	}
+}
+
+func TestSiteDataInvalid(t *testing.T) {
+	testSite(t)
+	writeFile(t, filepath.Join(config.DataDir, "broken.json"), `{"nav": [`)
+	if err := loadSite(); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("error = %v, want one naming the broken file", err)
+	}
+	if err := build(true); err == nil {
+		t.Error("build ran with broken site data")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// w3c date format used for lastmod
+const sitemapDateFormat = "2006-01-02"
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func writeSitemap(posts Posts) error {
+	// sort posts
+	sort.Sort(posts)
+
+	// index first, as recent as the latest update
+	var latest time.Time
+	for _, post := range posts {
+		if post.Modified.After(latest) {
+			latest = post.Modified
+		}
+	}
+	index := sitemapURL{Loc: config.BaseURL + "/"}
+	if !latest.IsZero() {
+		index.LastMod = latest.Format(sitemapDateFormat)
+	}
+	urlset := sitemapURLSet{URLs: []sitemapURL{index}}
+
+	for _, post := range posts {
+		urlset.URLs = append(urlset.URLs, sitemapURL{
+			Loc:     post.URL(),
+			LastMod: post.Modified.Format(sitemapDateFormat),
+		})
+	}
+
+	out, err := xml.MarshalIndent(urlset, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append([]byte(xml.Header), out...)
+
+	if err := writeOutputFile(filepath.Join(config.OutputDir, "sitemap.xml"), out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// write robots.txt with the RobotsDisallow rules and the sitemap location,
+// unless StaticDir has a robots.txt of its own
+func writeRobots() error {
+	if _, err := os.Stat(filepath.Join(config.StaticDir, "robots.txt")); err == nil {
+		log.Debug("Using robots.txt from " + config.StaticDir)
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if len(config.RobotsDisallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, rule := range config.RobotsDisallow {
+		b.WriteString("Disallow: " + rule + "\n")
+	}
+
+	// sitemap location has to be absolute
+	if config.BaseURL != "" {
+		b.WriteString("\nSitemap: " + config.BaseURL + "/sitemap.xml\n")
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, "robots.txt"), []byte(b.String()))
+}
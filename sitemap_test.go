@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+	config.OutputDir = t.TempDir()
+
+	posts := testPosts(4)
+	for i := range posts {
+		posts[i].Modified = posts[i].Date.Add(time.Duration(i) * time.Hour)
+	}
+	posts[2].Modified = time.Date(2022, 3, 4, 23, 0, 0, 0, time.UTC)
+	if err := writeSitemap(posts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.OutputDir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urlset sitemapURLSet
+	if err := xml.Unmarshal(data, &urlset); err != nil {
+		t.Fatalf("invalid sitemap: %v\n%s", err, data)
+	}
+	if len(urlset.URLs) != len(posts)+1 {
+		t.Fatalf("%d urls, want %d", len(urlset.URLs), len(posts)+1)
+	}
+
+	// the index, as recent as the latest post
+	if got := urlset.URLs[0]; got.Loc != "http://example.com/" || got.LastMod != "2022-03-04" {
+		t.Errorf("index entry = %+v", got)
+	}
+	lastmods := make(map[string]string)
+	for _, u := range urlset.URLs[1:] {
+		if _, err := time.Parse("2006-01-02", u.LastMod); err != nil {
+			t.Errorf("lastmod %q of %v isn't a W3C date", u.LastMod, u.Loc)
+		}
+		lastmods[u.Loc] = u.LastMod
+	}
+	if got := lastmods["http://example.com/post0.html"]; got != "2020-01-01" {
+		t.Errorf("lastmod of post0 = %q, want 2020-01-01", got)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+	if got, want := readOutput(t, "robots.txt"), "User-agent: *\nDisallow:\n\nSitemap: http://example.com/sitemap.xml\n"; got != want {
+		t.Errorf("robots.txt = %q, want %q", got, want)
+	}
+
+	config.RobotsDisallow = []string{"/drafts/", "/private/"}
+	testBuild(t)
+	if got, want := readOutput(t, "robots.txt"), "User-agent: *\nDisallow: /drafts/\nDisallow: /private/\n\nSitemap: http://example.com/sitemap.xml\n"; got != want {
+		t.Errorf("robots.txt = %q, want %q", got, want)
+	}
+}
+
+func TestRobotsStatic(t *testing.T) {
+	testSite(t)
+	const own = "User-agent: *\nDisallow: /\n"
+	writeFile(t, filepath.Join(config.StaticDir, "robots.txt"), own)
+	writeSource(t, "2020-01-01-post.md", "# Post\n")
+	testBuild(t)
+	testBuild(t)
+
+	if got := readOutput(t, "robots.txt"); got != own {
+		t.Errorf("robots.txt = %q, want the one from StaticDir", got)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// copy everything under StaticDir into OutputDir, skipping files whose size
+// and modification time match the copy already there
+func copyStatic() error {
+	if _, err := os.Stat(config.StaticDir); os.IsNotExist(err) {
+		log.Debugf("No static dir %v, nothing to copy", config.StaticDir)
+		return nil
+	}
+
+	return filepath.Walk(config.StaticDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(config.StaticDir, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(config.OutputDir, rel)
+		if hashed, ok := assetManifest[filepath.ToSlash(rel)]; ok {
+			dst = filepath.Join(config.OutputDir, filepath.FromSlash(hashed))
+		}
+
+		if info.IsDir() {
+			if *dryRun {
+				return nil
+			}
+			return os.MkdirAll(dst, info.Mode().Perm())
+		}
+
+		keepOutput(dst)
+
+		// unchanged since last copy
+		if out, err := os.Stat(dst); err == nil && out.Size() == info.Size() && out.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+
+		if *dryRun {
+			planWrite(dst, info.Size())
+			return nil
+		}
+		if err := copyFile(path, dst, info); err != nil {
+			return err
+		}
+		log.Debugf("Copied %v", rel)
+		return nil
+	})
+}
+
+// copy src to dst, carrying over mode and modification time from info
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// mode of an existing file isn't changed by OpenFile
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyStatic(t *testing.T) {
+	testSite(t)
+
+	binary := make([]byte, 1024)
+	for i := range binary {
+		binary[i] = byte(i * 7)
+	}
+	writeFile(t, filepath.Join(config.StaticDir, "css", "site.css"), "body{}")
+	writeFile(t, filepath.Join(config.StaticDir, "img", "icons", "logo.bin"), string(binary))
+	script := filepath.Join(config.StaticDir, "bin", "run.sh")
+	writeFile(t, script, "#!/bin/sh\n")
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyStatic(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t, "css/site.css"); got != "body{}" {
+		t.Errorf("site.css = %q", got)
+	}
+	if got := readOutput(t, "img/icons/logo.bin"); !bytes.Equal([]byte(got), binary) {
+		t.Error("binary file differs from its source")
+	}
+	info, err := os.Stat(filepath.Join(config.OutputDir, "bin", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("mode = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+func TestCopyStaticUnchanged(t *testing.T) {
+	testSite(t)
+	src := filepath.Join(config.StaticDir, "a.txt")
+	writeFile(t, src, "static")
+	if err := copyStatic(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy matching in size and time is left alone
+	dst := filepath.Join(config.OutputDir, "a.txt")
+	writeFile(t, dst, "edited")
+	info, _ := os.Stat(src)
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyStatic(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t, "a.txt"); got != "edited" {
+		t.Errorf("unchanged file copied again, got %q", got)
+	}
+
+	// a changed source is copied
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(src, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyStatic(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readOutput(t, "a.txt"); got != "static" {
+		t.Errorf("changed file not copied, got %q", got)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// absolute url of the listing page for term in taxonomy
+func termURL(taxonomy, term string) string {
+	return pageURL(pagePath(taxonomy + "/" + slugify(term)))
+}
+
+// terms of every taxonomy in front matter. a key may hold a single term or a
+// list of them.
+func postTerms(fm FrontMatter) map[string][]string {
+	terms := make(map[string][]string)
+	for name, key := range config.Taxonomies {
+		// keys with a FrontMatter field of their own never make it to Params
+		if i, ok := termField(key); ok {
+			switch v := reflect.ValueOf(fm).Field(i).Interface().(type) {
+			case string:
+				if v != "" {
+					terms[name] = []string{v}
+				}
+			case []string:
+				terms[name] = v
+			}
+			continue
+		}
+		switch v := fm.Params[key].(type) {
+		case string:
+			terms[name] = []string{v}
+		case []interface{}:
+			for _, term := range v {
+				terms[name] = append(terms[name], fmt.Sprint(term))
+			}
+		}
+	}
+	return terms
+}
+
+// index of the FrontMatter field for key, which has to be a string or list of
+// strings to hold terms
+func termField(key string) (int, bool) {
+	t := reflect.TypeOf(FrontMatter{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") != key {
+			continue
+		}
+		switch t.Field(i).Type {
+		case reflect.TypeOf(""), reflect.TypeOf([]string(nil)):
+			return i, true
+		}
+		return i, false
+	}
+	return 0, false
+}
+
+// write the listing page and feed of every term of every taxonomy
+func writeTaxonomyPages(posts Posts) error {
+	names := make([]string, 0, len(config.Taxonomies))
+	for name := range config.Taxonomies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeTermPages(name, posts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write <taxonomy>/<term>.html for each term of taxonomy with the
+// <taxonomy>.html template, or the optional tag.html if there is none, along
+// with a feed for each term
+func writeTermPages(taxonomy string, posts Posts) error {
+	// sort posts
+	sort.Sort(listingOrder{posts, false})
+
+	tmplPath := filepath.Join(config.TemplateDir, taxonomy+".html")
+	if _, err := os.Stat(tmplPath); err != nil {
+		tmplPath = filepath.Join(config.TemplateDir, "tag.html")
+		if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
+			tmplPath = ""
+		}
+	}
+
+	// group posts by term slug, keeping the first spelling of each term for display
+	names := make(map[string]string)
+	filed := make(map[string]Posts)
+	for _, post := range posts {
+		seen := make(map[string]bool)
+		for _, term := range post.Terms[taxonomy] {
+			slug := slugify(term)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			if _, ok := names[slug]; !ok {
+				names[slug] = term
+			}
+			filed[slug] = append(filed[slug], post)
+		}
+	}
+
+	for slug, termPosts := range filed {
+		if tmplPath != "" {
+			if err := writeTermPage(tmplPath, taxonomy, slug, names[slug], termPosts); err != nil {
+				return err
+			}
+		}
+
+		// term scoped feed
+		if err := writeTermFeed(taxonomy, names[slug], termPosts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write the listing page of the posts filed under name in taxonomy
+func writeTermPage(tmplPath, taxonomy, slug, name string, posts Posts) error {
+	term := struct {
+		Taxonomy,
+		Tag, // the term, named for tag.html
+		FeedURL string
+		Posts Posts
+		Site  Site
+	}{
+		taxonomy,
+		name,
+		termFeedURL(taxonomy, name),
+		posts,
+		site,
+	}
+
+	out, err := renderTemplate(tmplPath, term)
+	if err != nil {
+		return err
+	}
+
+	page := Page{
+		name,
+		string(out),
+	}
+
+	// tuck term listing into main template
+	out, err = renderTemplate(filepath.Join(config.TemplateDir, "main.html"), page)
+	if err != nil {
+		return err
+	}
+
+	return writeOutputFile(filepath.Join(config.OutputDir, filepath.FromSlash(pagePath(taxonomy+"/"+slug))), out)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagPages(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-three.md", "---\ntitle: Three Tags\ntags: [Go, Web Dev, a/b]\n---\nbody\n")
+	writeSource(t, "2020-01-02-one.md", "---\ntitle: One Tag\ntags: [other]\n---\nbody\n")
+	testBuild(t)
+
+	files, err := ioutil.ReadDir(filepath.Join(config.OutputDir, "tags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := 0
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".html" {
+			continue
+		}
+		if strings.Contains(readOutput(t, "tags/"+f.Name()), "Three Tags") {
+			pages++
+		}
+	}
+	if pages != 3 {
+		t.Errorf("post appears on %d tag pages, want 3", pages)
+	}
+
+	// names are slugified into safe filenames
+	for _, p := range []string{"tags/go.html", "tags/web-dev.html", "tags/a-b.html"} {
+		if page := readOutput(t, p); !strings.Contains(page, "Three Tags") || strings.Contains(page, "One Tag") {
+			t.Errorf("%v doesn't list just the tagged post", p)
+		}
+	}
+}
+
+func TestSlugifyTags(t *testing.T) {
+	for tag, want := range map[string]string{
+		"Go":          "go",
+		"Web Dev":     "web-dev",
+		"a/b":         "a-b",
+		"../etc":      "etc",
+		"  C++  ":     "c",
+		"UPPER/Lower": "upper-lower",
+	} {
+		if got := slugify(tag); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestTagFeeds(t *testing.T) {
+	testSite(t)
+	config.FeedLimit = 2
+	writeSource(t, "2020-01-01-go1.md", "---\ntitle: Go One\ntags: [go]\n---\nbody\n")
+	writeSource(t, "2020-01-02-go2.md", "---\ntitle: Go Two\ntags: [Go, web]\n---\nbody\n")
+	writeSource(t, "2020-01-03-go3.md", "---\ntitle: Go Three\ntags: [go]\n---\nbody\n")
+	writeSource(t, "2020-01-04-web.md", "---\ntitle: Web Only\ntags: [web]\n---\nbody\n")
+	testBuild(t)
+
+	// the plain link and atom:link share a local name, so they're told apart
+	// by namespace
+	var feed struct {
+		Links []struct {
+			XMLName xml.Name
+			Href    string `xml:"href,attr"`
+			Value   string `xml:",chardata"`
+		} `xml:"channel>link"`
+		Items []rssItem `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal([]byte(readOutput(t, "tags/go/feed.xml")), &feed); err != nil {
+		t.Fatal(err)
+	}
+	links := make(map[string]string)
+	for _, l := range feed.Links {
+		links[l.XMLName.Space] = l.Href + l.Value
+	}
+	if got := links["http://www.w3.org/2005/Atom"]; got != "http://example.com/tags/go/feed.xml" {
+		t.Errorf("self url = %q", got)
+	}
+	if got := links[""]; got != "http://example.com/tags/go.html" {
+		t.Errorf("link = %q", got)
+	}
+	var titles []string
+	for _, item := range feed.Items {
+		titles = append(titles, item.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Go Three,Go Two" {
+		t.Errorf("go feed items = %v, want the two newest go posts", got)
+	}
+
+	// the tag page links its feed
+	if !strings.Contains(readOutput(t, "tags/go.html"), `href="http://example.com/tags/go/feed.xml"`) {
+		t.Error("tag page doesn't link its feed")
+	}
+}
+
+func TestTaxonomies(t *testing.T) {
+	testSite(t)
+	config.Taxonomies = map[string]string{"tags": "tags", "categories": "category", "series": "series", "authors": "author"}
+	writeSource(t, "2020-01-01-one.md", "---\ntitle: Part One\ncategory: Go Notes\nseries: Learning Go\nauthor: Ann\ntags: [go]\n---\nbody\n")
+	writeSource(t, "2020-01-02-two.md", "---\ntitle: Part Two\ncategory: [Go Notes, Web]\nseries: Learning Go\nauthor: Bob\n---\nbody\n")
+	writeSource(t, "2020-01-03-other.md", "---\ntitle: Other\ncategory: Web\n---\nbody\n")
+	testBuild(t)
+
+	for p, want := range map[string][]string{
+		"categories/go-notes.html": {"Part One", "Part Two"},
+		"categories/web.html":      {"Part Two", "Other"},
+		"series/learning-go.html":  {"Part One", "Part Two"},
+		"authors/ann.html":         {"Part One"},
+		"authors/bob.html":         {"Part Two"},
+		"tags/go.html":             {"Part One"},
+	} {
+		page := readOutput(t, p)
+		for _, title := range []string{"Part One", "Part Two", "Other"} {
+			listed := strings.Contains(page, title)
+			wanted := strings.Contains(strings.Join(want, ","), title)
+			if listed != wanted {
+				t.Errorf("%v lists %v: %v, want %v", p, title, listed, wanted)
+			}
+		}
+	}
+	if outputExistsAt(t, "tags/web.html") || outputExistsAt(t, "series/web.html") {
+		t.Error("terms of one taxonomy listed in another")
+	}
+}
+
+func TestPostTerms(t *testing.T) {
+	testConfig(t)
+	config.Taxonomies = map[string]string{"tags": "tags", "categories": "category", "authors": "author", "series": "series"}
+	fm, _, err := parseFrontMatter([]byte("---\ntags: [a, b]\ncategory: [x, 2]\nauthor: Ann\nseries: \"\"\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"tags": {"a", "b"}, "categories": {"x", "2"}, "authors": {"Ann"}}
+	if got := postTerms(fm); !reflect.DeepEqual(got, want) {
+		t.Errorf("postTerms = %v, want %v", got, want)
+	}
+}
+
+func TestTaxonomiesConfig(t *testing.T) {
+	// tags are always a taxonomy
+	if err := loadConfig(t, "config.json", `{"Taxonomies": {"categories": "category"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"tags": "tags", "categories": "category"}; !reflect.DeepEqual(config.Taxonomies, want) {
+		t.Errorf("Taxonomies = %v, want %v", config.Taxonomies, want)
+	}
+
+	for _, taxonomies := range []string{
+		`{"Bad Name": "x"}`,
+		`{"../up": "x"}`,
+		`{"empty": ""}`,
+		`{"drafts": "draft"}`,
+		`{"parts": "part"}`,
+	} {
+		if err := loadConfig(t, "config.json", `{"Taxonomies": `+taxonomies+`}`); err == nil || !strings.Contains(err.Error(), "Invalid taxonomy") {
+			t.Errorf("%v: error = %v, want an invalid taxonomy", taxonomies, err)
+		}
+	}
+}
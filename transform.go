@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/html"
+	nethtml "golang.org/x/net/html"
+)
+
+// html minifier used when Minify is set. whitespace inside <pre> is kept by
+// the minifier itself.
+var minifier = newMinifier()
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.Add("text/html", &html.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+	})
+	return m
+}
+
+func minifyHTML(data []byte) ([]byte, error) {
+	return minifier.Bytes("text/html", data)
+}
+
+// sanitization policies by SanitizePolicy name
+var sanitizePolicies = map[string]func() *bluemonday.Policy{
+	"ugc":    ugcPolicy,
+	"strict": bluemonday.StrictPolicy,
+}
+
+// user generated content policy, keeping the classes of highlighted code
+// and footnotes
+func ugcPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Globally()
+	return p
+}
+
+// policies by name, built on first use. a config reload may pick another.
+var sanitizers struct {
+	sync.Mutex
+	policies map[string]*bluemonday.Policy
+}
+
+// strip scripts, event handlers and other dangerous markup from rendered html
+func sanitizeHTML(data []byte) []byte {
+	sanitizers.Lock()
+	if sanitizers.policies == nil {
+		sanitizers.policies = make(map[string]*bluemonday.Policy)
+	}
+	policy, ok := sanitizers.policies[config.SanitizePolicy]
+	if !ok {
+		policy = sanitizePolicies[config.SanitizePolicy]()
+		sanitizers.policies[config.SanitizePolicy] = policy
+	}
+	sanitizers.Unlock()
+	return policy.SanitizeBytes(data)
+}
+
+// code spans and blocks, whose html examples stay as written, or the start of
+// a root relative link or image, or of a protocol relative one
+var rootLinkPattern = regexp.MustCompile(`(?is)<pre\b.*?</pre>|<code\b.*?</code>|\b(?:href|src)=["']//?`)
+
+// prefix root relative href and src attributes with PathPrefix, leaving
+// absolute, protocol relative and fragment links and code alone
+func prefixPaths(data []byte) []byte {
+	if config.PathPrefix == "" {
+		return data
+	}
+	return rootLinkPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		if m[0] == '<' || bytes.HasSuffix(m, []byte("//")) {
+			return m
+		}
+		out := append([]byte(nil), m[:len(m)-1]...)
+		return append(append(out, config.PathPrefix...), '/')
+	})
+}
+
+// outputs getting a .gz copy with PrecompressGzip
+var gzipExts = map[string]bool{
+	".html": true,
+	".xml":  true,
+	".json": true,
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	imgPattern      = regexp.MustCompile(`<img\b[^>]*>`)
+	imgSrcPattern   = regexp.MustCompile(`\bsrc=["']([^"']+)["']`)
+	imgSizedPattern = regexp.MustCompile(`\b(?:width|height)=`)
+	imgClosePattern = regexp.MustCompile(`\s*/?>$`)
+)
+
+// dimensions of decoded images by file, nil for those that can't be decoded.
+// entries are only used while the file's modification time matches.
+var imageSizes struct {
+	sync.Mutex
+	files map[string]imageSizeEntry
+}
+
+type imageSizeEntry struct {
+	modTime time.Time
+	size    *image.Config
+}
+
+// add width and height to img tags without them, for images in StaticDir in
+// a format the image package decodes. dir is the slash separated directory
+// of the page relative to OutputDir, for relative srcs.
+func addImageSizes(data []byte, dir string) []byte {
+	return imgPattern.ReplaceAllFunc(data, func(tag []byte) []byte {
+		src := imgSrcPattern.FindSubmatch(tag)
+		if src == nil || imgSizedPattern.Match(tag) {
+			return tag
+		}
+		file, ok := staticImage(string(src[1]), dir)
+		if !ok {
+			return tag
+		}
+		size := imageSize(file)
+		if size == nil {
+			return tag
+		}
+
+		end := imgClosePattern.FindIndex(tag)
+		attrs := fmt.Sprintf(` width="%d" height="%d"`, size.Width, size.Height)
+		return []byte(string(tag[:end[0]]) + attrs + string(tag[end[0]:]))
+	})
+}
+
+// file in StaticDir a root relative, BaseURL or page relative src refers to
+func staticImage(src, dir string) (string, bool) {
+	if config.BaseURL != "" && strings.HasPrefix(src, config.BaseURL+"/") {
+		src = src[len(config.BaseURL):]
+	}
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+	if src == "" || strings.HasPrefix(src, "//") || strings.Contains(src, ":") {
+		return "", false
+	}
+	if !strings.HasPrefix(src, "/") {
+		src = path.Join("/", dir, src)
+	}
+	return filepath.Join(config.StaticDir, filepath.FromSlash(path.Clean(src))), true
+}
+
+// decoded dimensions of the image in file, remembered for later pages
+func imageSize(file string) *image.Config {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil
+	}
+
+	imageSizes.Lock()
+	defer imageSizes.Unlock()
+	if imageSizes.files == nil {
+		imageSizes.files = make(map[string]imageSizeEntry)
+	}
+	if entry, ok := imageSizes.files[file]; ok && entry.modTime.Equal(info.ModTime()) {
+		return entry.size
+	}
+
+	var size *image.Config
+	if f, err := os.Open(file); err == nil {
+		if c, _, err := image.DecodeConfig(f); err == nil {
+			size = &c
+		}
+		f.Close()
+	}
+	imageSizes.files[file] = imageSizeEntry{info.ModTime(), size}
+	return size
+}
+
+// elements without an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// cut content after chars characters of text or after paragraphs top level
+// elements, whichever comes first, closing the elements left open. zero
+// means no limit. reports whether anything was cut.
+func truncateHTML(content string, chars, paragraphs int) (string, bool) {
+	if chars <= 0 && paragraphs <= 0 {
+		return content, false
+	}
+
+	var b strings.Builder
+	var open []string
+	count, blocks := 0, 0
+	z := nethtml.NewTokenizer(strings.NewReader(content))
+
+	// everything after the cut has to be whitespace for nothing to be cut
+	rest := func() bool {
+		for {
+			switch z.Next() {
+			case nethtml.ErrorToken:
+				return false
+			case nethtml.TextToken:
+				if strings.TrimSpace(string(z.Text())) != "" {
+					return true
+				}
+			case nethtml.CommentToken:
+			default:
+				return true
+			}
+		}
+	}
+	// count a finished top level block, reporting whether it is the last one
+	endBlock := func() bool {
+		blocks++
+		return paragraphs > 0 && blocks >= paragraphs
+	}
+	done := func() (string, bool) {
+		out := b.String()
+		if rest() {
+			return out, true
+		}
+		return content, false
+	}
+	closeAll := func() string {
+		for i := len(open) - 1; i >= 0; i-- {
+			b.WriteString("</" + open[i] + ">")
+		}
+		return b.String()
+	}
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case nethtml.ErrorToken:
+			return content, false
+		case nethtml.TextToken:
+			// Text unescapes in place, so the raw text is kept first
+			raw := append([]byte(nil), z.Raw()...)
+			text := string(z.Text())
+			n := utf8.RuneCountInString(text)
+			if chars > 0 && count+n > chars {
+				// end on a word boundary where there is one
+				runes := []rune(text)[:chars-count]
+				cut := string(runes)
+				if i := strings.LastIndexFunc(cut, unicode.IsSpace); i >= 0 {
+					cut = cut[:i]
+				}
+				b.WriteString(nethtml.EscapeString(strings.TrimRightFunc(cut, unicode.IsSpace)) + "…")
+				return closeAll(), true
+			}
+			count += n
+			b.Write(raw)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			b.Write(z.Raw())
+			name, _ := z.TagName()
+			if tt == nethtml.StartTagToken && !voidElements[string(name)] {
+				open = append(open, string(name))
+				continue
+			}
+			// a top level <hr> or <img> is a block of its own
+			if len(open) == 0 && endBlock() {
+				return done()
+			}
+		case nethtml.EndTagToken:
+			b.Write(z.Raw())
+			name, _ := z.TagName()
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == string(name) {
+					open = open[:i]
+					break
+				}
+			}
+			if len(open) == 0 && endBlock() {
+				return done()
+			}
+		default:
+			b.Write(z.Raw())
+		}
+	}
+}
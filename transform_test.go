@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const codeSource = "# Code\n\nSome   text\n\n    func main() {\n        indented()\n    }\n"
+
+func TestMinify(t *testing.T) {
+	testSite(t)
+	writeSource(t, "2020-01-01-code.md", codeSource)
+	testBuild(t)
+	plain := readOutput(t, "code.html")
+
+	config.Minify = true
+	testBuild(t)
+	minified := readOutput(t, "code.html")
+	if len(minified) >= len(plain) {
+		t.Errorf("minified page is %d bytes, plain %d", len(minified), len(plain))
+	}
+	pre := "<pre><code>func main() {\n    indented()\n}\n</code></pre>"
+	if !strings.Contains(plain, pre) || !strings.Contains(minified, pre) {
+		t.Errorf("pre formatted code changed:\n%s\n---\n%s", plain, minified)
+	}
+	if strings.Contains(minified, "\n\t") {
+		t.Errorf("indentation left in minified page:\n%s", minified)
+	}
+}
+
+func TestMinifyLeavesFeed(t *testing.T) {
+	testSite(t)
+	config.Minify = true
+	writeSource(t, "2020-01-01-post.md", "# Post\n\nbody\n")
+	testBuild(t)
+
+	// feed.html is rss in spite of its name
+	feed := readOutput(t, "feed.html")
+	var rss struct {
+		XMLName xml.Name `xml:"rss"`
+		Items   []struct {
+			Title string `xml:"title"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal([]byte(feed), &rss); err != nil {
+		t.Fatalf("feed.html isn't valid xml after minifying: %v\n%s", err, feed)
+	}
+	if len(rss.Items) != 1 || rss.Items[0].Title != "Post" {
+		t.Errorf("items = %+v", rss.Items)
+	}
+}
+
+func TestPrefixPaths(t *testing.T) {
+	testConfig(t)
+	in := `<a href="/x">x</a> <img src="/y.png"> <a href='/z'>z</a> <a href="http://example.org/a">a</a> ` +
+		`<a href="https://example.org/b">b</a> <a href="#frag">f</a> <a href="//cdn.example.org/c">c</a> <a href="rel/d">d</a>`
+
+	if got := string(prefixPaths([]byte(in))); got != in {
+		t.Errorf("changed without PathPrefix:\n%v", got)
+	}
+
+	config.PathPrefix = "/blog"
+	want := `<a href="/blog/x">x</a> <img src="/blog/y.png"> <a href='/blog/z'>z</a> <a href="http://example.org/a">a</a> ` +
+		`<a href="https://example.org/b">b</a> <a href="#frag">f</a> <a href="//cdn.example.org/c">c</a> <a href="rel/d">d</a>`
+	if got := string(prefixPaths([]byte(in))); got != want {
+		t.Errorf("prefixPaths =\n%v\nwant\n%v", got, want)
+	}
+
+	// html examples in code stay as written
+	code := "<pre><code class=\"language-html\">&lt;a href='/x'&gt;</code></pre> <code>src=\"/y\"</code> <a href=\"/z\">z</a>"
+	want = "<pre><code class=\"language-html\">&lt;a href='/x'&gt;</code></pre> <code>src=\"/y\"</code> <a href=\"/blog/z\">z</a>"
+	if got := string(prefixPaths([]byte(code))); got != want {
+		t.Errorf("prefixPaths with code =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestPathPrefixConfig(t *testing.T) {
+	for prefix, want := range map[string]string{"": "", "/": "", "blog": "/blog", "/blog/": "/blog", "a/b/": "/a/b"} {
+		if err := loadConfig(t, "config.json", `{"PathPrefix": "`+prefix+`"}`); err != nil {
+			t.Fatal(err)
+		}
+		if config.PathPrefix != want {
+			t.Errorf("PathPrefix %q = %q, want %q", prefix, config.PathPrefix, want)
+		}
+	}
+}
+
+func TestPathPrefixBuild(t *testing.T) {
+	testSite(t)
+	config.PathPrefix = "/blog"
+	writeSource(t, "2020-01-01-post.md", "# Post\n\n![img](/img/a.png) [home](/) [ext](http://example.org/)\n\n"+
+		"```html\n<a href='/docs'>docs</a> <img src='/logo.png'>\n```\n")
+	testBuild(t)
+
+	page := readOutput(t, "post.html")
+	for _, want := range []string{`src="/blog/img/a.png"`, `href="/blog/"`, `href="http://example.org/"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("post page lacks %v:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "/blog/docs") || strings.Contains(page, "/blog/logo.png") {
+		t.Errorf("code block prefixed:\n%s", page)
+	}
+}
+
+func TestPrecompressGzip(t *testing.T) {
+	testSite(t)
+	config.PrecompressGzip = true
+	writeSource(t, "2020-01-01-post.md", "# Post\n\nbody\n")
+	writeFile(t, filepath.Join(config.StaticDir, "img", "a.png"), "\x89PNG")
+	testBuild(t)
+
+	for _, p := range []string{"post.html", "index.html", "rss.xml", "sitemap.xml"} {
+		gz, err := ioutil.ReadFile(filepath.Join(config.OutputDir, filepath.FromSlash(p+".gz")))
+		if err != nil {
+			t.Errorf("no gzip copy of %v: %v", p, err)
+			continue
+		}
+		r, err := gzip.NewReader(bytes.NewReader(gz))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != readOutput(t, p) {
+			t.Errorf("%v.gz doesn't decompress to %v", p, p)
+		}
+	}
+	for _, p := range []string{"img/a.png", "robots.txt", buildCacheFile} {
+		if outputExistsAt(t, p+".gz") {
+			t.Errorf("%v gzipped", p)
+		}
+	}
+}
+
+// write a blank png of the given size to name
+func writePNG(t *testing.T, name string, width, height int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddImageSizes(t *testing.T) {
+	testSite(t)
+	writePNG(t, filepath.Join(config.StaticDir, "img", "a.png"), 30, 20)
+	writePNG(t, filepath.Join(config.StaticDir, "posts", "b.png"), 4, 5)
+	writeFile(t, filepath.Join(config.StaticDir, "img", "broken.png"), "not a png")
+
+	for in, want := range map[string]string{
+		`<img src="/img/a.png">`:                        `<img src="/img/a.png" width="30" height="20">`,
+		`<img src="/img/a.png" />`:                      `<img src="/img/a.png" width="30" height="20" />`,
+		`<img alt="a" src='/img/a.png?v=1'>`:            `<img alt="a" src='/img/a.png?v=1' width="30" height="20">`,
+		`<img src="http://example.com/img/a.png">`:      `<img src="http://example.com/img/a.png" width="30" height="20">`,
+		`<img src="b.png">`:                             `<img src="b.png" width="4" height="5">`,
+		`<img src="/img/a.png" width="10">`:             `<img src="/img/a.png" width="10">`,
+		`<img src="http://example.org/img/a.png">`:      `<img src="http://example.org/img/a.png">`,
+		`<img src="//cdn.example.org/img/a.png">`:       `<img src="//cdn.example.org/img/a.png">`,
+		`<img src="/img/missing.png">`:                  `<img src="/img/missing.png">`,
+		`<img src="/img/broken.png">`:                   `<img src="/img/broken.png">`,
+		`<img src="data:image/png;base64,iVBORw0KGgo">`: `<img src="data:image/png;base64,iVBORw0KGgo">`,
+	} {
+		if got := string(addImageSizes([]byte(in), "posts")); got != want {
+			t.Errorf("addImageSizes(%v) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestImageSizesBuild(t *testing.T) {
+	testSite(t)
+	writePNG(t, filepath.Join(config.StaticDir, "img", "a.png"), 30, 20)
+	writeSource(t, "2020-01-01-post.md", "# Post\n\n![alt](/img/a.png)\n")
+	testBuild(t)
+	if got := readOutput(t, "post.html"); !strings.Contains(got, `width="30" height="20"`) {
+		t.Errorf("post page lacks the image size:\n%s", got)
+	}
+
+	// a changed image is read again
+	writePNG(t, filepath.Join(config.StaticDir, "img", "a.png"), 60, 40)
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(config.StaticDir, "img", "a.png"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	testBuild(t)
+	if got := readOutput(t, "post.html"); !strings.Contains(got, `width="60" height="40"`) {
+		t.Errorf("post page lacks the new image size:\n%s", got)
+	}
+}
+
+const unsafeSource = "# Post\n\n<script>alert(1)</script>\n\n<p onclick=\"steal()\">Hello <b>world</b></p>\n\n<a href=\"javascript:alert(1)\">bad</a>\n"
+
+func TestSanitize(t *testing.T) {
+	testSite(t)
+	post, err := parseSourceFile(writeSource(t, "2020-01-01-post.md", unsafeSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(post.Content, "<script>alert(1)</script>") || !strings.Contains(post.Content, "onclick") {
+		t.Errorf("raw html changed without Sanitize:\n%s", post.Content)
+	}
+
+	config.Sanitize = true
+	post, err = parseSourceFile(writeSource(t, "2020-01-01-post.md", unsafeSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"<script", "alert(1)", "onclick", "javascript:"} {
+		if strings.Contains(post.Content, bad) {
+			t.Errorf("sanitized content has %v:\n%s", bad, post.Content)
+		}
+	}
+	if !strings.Contains(post.Content, "Hello <b>world</b>") || !strings.Contains(post.Content, `<h1 id="post">`) {
+		t.Errorf("sanitizing lost safe markup:\n%s", post.Content)
+	}
+}
+
+func TestSanitizePolicy(t *testing.T) {
+	testConfig(t)
+	config.Sanitize = true
+	in := []byte(`<p class="note">Hello <b>world</b></p>`)
+
+	if got := string(sanitizeHTML(in)); got != `<p class="note">Hello <b>world</b></p>` {
+		t.Errorf("ugc policy gave %q", got)
+	}
+	config.SanitizePolicy = "strict"
+	if got := string(sanitizeHTML(in)); got != "Hello world" {
+		t.Errorf("strict policy gave %q", got)
+	}
+
+	if err := loadConfig(t, "config.json", `{"SanitizePolicy": "lax"}`); err == nil || !strings.Contains(err.Error(), "lax") {
+		t.Errorf("error = %v, want one naming the invalid policy", err)
+	}
+}
+
+func TestTruncateHTML(t *testing.T) {
+	const content = "<p>First <em>emphasised words</em> here.</p>\n<p>Second &amp; more.</p>\n<ul><li>one</li><li>two</li></ul>\n"
+	for _, tc := range []struct {
+		chars, paragraphs int
+		want              string
+		cut               bool
+	}{
+		{0, 0, content, false},
+		{0, 1, "<p>First <em>emphasised words</em> here.</p>", true},
+		{0, 2, "<p>First <em>emphasised words</em> here.</p>\n<p>Second &amp; more.</p>", true},
+		{0, 3, content, false},
+		{0, 10, content, false},
+		// cut inside the em, closing the open tags, on a word boundary
+		{20, 0, "<p>First <em>emphasised…</em></p>", true},
+		// a space starting the text still counts as the boundary
+		{24, 0, "<p>First <em>emphasised words</em>…</p>", true},
+		// without a space in the text the word itself is cut
+		{8, 0, "<p>First <em>em…</em></p>", true},
+		// entities count as one character and stay escaped
+		{38, 0, "<p>First <em>emphasised words</em> here.</p>\n<p>Second &amp;…</p>", true},
+		{1000, 0, content, false},
+		// whichever limit comes first
+		{20, 2, "<p>First <em>emphasised…</em></p>", true},
+		{1000, 1, "<p>First <em>emphasised words</em> here.</p>", true},
+	} {
+		got, cut := truncateHTML(content, tc.chars, tc.paragraphs)
+		if got != tc.want || cut != tc.cut {
+			t.Errorf("truncateHTML(%d, %d) = %q, %v, want %q, %v", tc.chars, tc.paragraphs, got, cut, tc.want, tc.cut)
+		}
+	}
+
+	// top level void elements are blocks too
+	const voids = "<p>One.</p>\n<hr>\n<img src=\"a.png\" />\n<p>Two.</p>\n"
+	for paragraphs, want := range map[int]string{
+		2: "<p>One.</p>\n<hr>",
+		3: "<p>One.</p>\n<hr>\n<img src=\"a.png\" />",
+	} {
+		if got, cut := truncateHTML(voids, 0, paragraphs); got != want || !cut {
+			t.Errorf("truncateHTML(0, %d) = %q, %v, want %q, true", paragraphs, got, cut, want)
+		}
+	}
+	if got, cut := truncateHTML(voids, 0, 4); got != voids || cut {
+		t.Errorf("truncateHTML(0, 4) = %q, %v, want it in full", got, cut)
+	}
+}
+
+func TestIndexContent(t *testing.T) {
+	testConfig(t)
+	config.BaseURL = "http://example.com"
+	config.IndexParagraphs = 1
+	long := Post{Slug: "long", Content: "<p>One.</p>\n<p>Two.</p>\n"}
+	short := Post{Slug: "short", Content: "<p>Only.</p>\n"}
+
+	if got, want := long.IndexContent(), "<p>One.</p>\n<p class=\"more\"><a href=\"http://example.com/long.html\">Read more</a></p>"; got != want {
+		t.Errorf("long post = %q, want %q", got, want)
+	}
+	if got := short.IndexContent(); got != short.Content {
+		t.Errorf("short post = %q, want it in full", got)
+	}
+}
+
+func TestIndexContentBuild(t *testing.T) {
+	testSite(t)
+	config.IndexTruncate = 10
+	writeFile(t, filepath.Join(config.TemplateDir, "index.html"), `{{ range .Posts }}[{{ .IndexContent }}]{{ end }}`)
+	writeSource(t, "2020-01-02-long.md", "---\ntitle: Long\n---\nA *longer* post body here.\n")
+	writeSource(t, "2020-01-01-short.md", "---\ntitle: Short\n---\nShort.\n")
+	testBuild(t)
+
+	got := readOutput(t, "index.html")
+	want := "[<p>A <em>longer</em>…</p>\n<p class=\"more\"><a href=\"http://example.com/long.html\">Read more</a></p>][<p>Short.</p>\n]"
+	if got != want {
+		t.Errorf("index = %q, want %q", got, want)
+	}
+	if post := readOutput(t, "long.html"); !strings.Contains(post, "A <em>longer</em> post body here.") {
+		t.Errorf("post page cut too:\n%v", post)
+	}
+}
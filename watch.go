@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// how long to wait for further changes before rebuilding
+const watchDelay = 200 * time.Millisecond
+
+// build, then rebuild whenever anything under SourceDir or TemplateDir
+// changes. onBuild, if set, runs after every build.
+func watch(onBuild func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range []string{config.SourceDir, config.TemplateDir} {
+		if err := watchDirs(watcher, dir); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Watching %v and %v for changes", config.SourceDir, config.TemplateDir)
+	return watchChanges(watcher, onBuild)
+}
+
+// build, then rebuild on the events of watcher until it's closed
+func watchChanges(watcher *fsnotify.Watcher, onBuild func()) error {
+	rebuild(*force, onBuild)
+
+	// template changes affect every post, so they bypass the build cache
+	templatesChanged := false
+	debounce := time.NewTimer(watchDelay)
+	debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// new directories need watching too
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchDirs(watcher, event.Name); err != nil {
+						log.Error(err)
+					}
+				}
+			}
+			if excluded(event.Name) {
+				continue
+			}
+			if isUnder(event.Name, config.TemplateDir) {
+				templatesChanged = true
+			}
+			debounce.Reset(watchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Error(err)
+		case <-debounce.C:
+			rebuild(*force || templatesChanged, onBuild)
+			templatesChanged = false
+		}
+	}
+}
+
+// run a build, logging when it started and how long it took
+func rebuild(force bool, onBuild func()) {
+	start := time.Now()
+	log.Infof("Building at %v", start.Format("15:04:05"))
+	if err := build(force); err != nil {
+		log.Error(err)
+	}
+	log.Info(statsSummary())
+
+	if onBuild != nil {
+		onBuild()
+	}
+}
+
+// add root and all directories below it to watcher
+func watchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// report whether path is dir or inside it
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
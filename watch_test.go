@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchRebuilds(t *testing.T) {
+	testSite(t)
+	src := writeSource(t, "2020-01-01-post.md", "# Before\n")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{config.SourceDir, config.TemplateDir} {
+		if err := watchDirs(watcher, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	builds := make(chan bool, 10)
+	done := make(chan error)
+	go func() { done <- watchChanges(watcher, func() { builds <- true }) }()
+
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case <-builds:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no build %v", what)
+		}
+	}
+	wait("on start")
+	if !strings.Contains(readOutput(t, "before.html"), "Before") {
+		t.Error("first build didn't write the post")
+	}
+
+	// a burst of writes gives a single rebuild
+	for i := 0; i < 3; i++ {
+		writeFile(t, src, "# After\n")
+	}
+	wait("after writing a source file")
+	if !strings.Contains(readOutput(t, "after.html"), "After") {
+		t.Error("rebuild didn't pick up the change")
+	}
+	select {
+	case <-builds:
+		t.Error("more than one rebuild for a burst of writes")
+	case <-time.After(2 * watchDelay):
+	}
+
+	// new directories are watched too
+	writeSource(t, "nested/2020-01-02-new.md", "# New\n")
+	wait("after adding a directory")
+	writeFile(t, filepath.Join(config.SourceDir, "nested", "2020-01-03-newer.md"), "# Newer\n")
+	wait("after writing to a new directory")
+	readOutput(t, "nested/newer.html")
+
+	watcher.Close()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}